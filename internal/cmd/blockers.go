@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// printDeletionBlockers writes what blocks the deletion of the namespaces:
+// every remaining resource with its deletion timestamp and finalizers,
+// followed by the API group versions that couldn't be discovered, since a
+// namespace isn't deleted until the resources of every API are deleted. The
+// other failures are reported as usual.
+func (c *Cmd) printDeletionBlockers(resources []*kubectl.Resource, partialErr *PartialFetchError) error {
+	var discoveryFailures, otherFailures []*FetchError
+	if partialErr != nil {
+		for _, failure := range partialErr.Failures {
+			var discoveryErr *kubectl.PartialDiscoveryError
+			if failure.Kind == "" && errors.As(failure.Err, &discoveryErr) {
+				discoveryFailures = append(discoveryFailures, failure)
+			} else {
+				otherFailures = append(otherFailures, failure)
+			}
+		}
+	}
+	bufferedStdout := bufio.NewWriter(c.stdout)
+	if len(resources) > 0 {
+		if err := c.writeRemainingResources(bufferedStdout, resources); err != nil {
+			return err
+		}
+	}
+	if len(discoveryFailures) > 0 {
+		if len(resources) > 0 {
+			fmt.Fprintln(bufferedStdout)
+		}
+		fmt.Fprintln(bufferedStdout, "Failing aggregated APIs:")
+		for _, line := range failedAPIs(discoveryFailures) {
+			fmt.Fprintln(bufferedStdout, "  "+line)
+		}
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return err
+	}
+	var finalized int
+	for _, resource := range resources {
+		if len(resource.Metadata.Finalizers) > 0 {
+			finalized++
+		}
+	}
+	if len(resources) == 0 {
+		fmt.Fprintln(c.stderr, "No resources remain.")
+	} else {
+		fmt.Fprintf(c.stderr, "%d resources remain, %d with finalizers.\n", len(resources), finalized)
+	}
+	if len(otherFailures) == 0 {
+		return nil
+	}
+	return c.reportPartialFailure(&PartialFetchError{Failures: otherFailures})
+}
+
+// writeRemainingResources writes a table of the resources with how long ago
+// their deletion was requested and their finalizers.
+func (c *Cmd) writeRemainingResources(w io.Writer, resources []*kubectl.Resource) error {
+	table := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	var header []string
+	if c.options.multiCluster() {
+		header = append(header, "CONTEXT")
+	}
+	if c.options.showNamespaces() {
+		header = append(header, "NAMESPACE")
+	}
+	header = append(header, "NAME", "DELETING", "FINALIZERS")
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	now := c.Now()
+	for _, resource := range resources {
+		var row []string
+		if c.options.multiCluster() {
+			row = append(row, resource.Cluster)
+		}
+		if c.options.showNamespaces() {
+			row = append(row, resource.Namespace())
+		}
+		var deleting string
+		if deletionTimestamp := resource.Metadata.DeletionTimestamp; deletionTimestamp != nil {
+			deleting = formatAge(now.Sub(*deletionTimestamp))
+		}
+		row = append(row,
+			resource.String(),
+			valueOrNone(deleting),
+			valueOrNone(strings.Join(resource.Metadata.Finalizers, ",")),
+		)
+		fmt.Fprintln(table, strings.Join(row, "\t"))
+	}
+	return table.Flush()
+}
+
+// failedAPIs returns the API group versions that couldn't be discovered,
+// with the reason, prefixed by their context between brackets when it's
+// set. e.g. [prod] metrics.k8s.io/v1beta1: the server is currently unable to
+// handle the request
+func failedAPIs(discoveryFailures []*FetchError) []string {
+	var lines []string
+	for _, failure := range discoveryFailures {
+		var prefix string
+		if failure.Cluster != "" {
+			prefix = "[" + failure.Cluster + "] "
+		}
+		var discoveryErr *kubectl.PartialDiscoveryError
+		errors.As(failure.Err, &discoveryErr)
+		failed := discoveryErr.FailedGroupVersions()
+		if len(failed) == 0 {
+			// kubectl errors span many lines, keep them on a single line
+			lines = append(lines, prefix+strings.Join(strings.Fields(discoveryErr.Message), " "))
+			continue
+		}
+		groupVersions := make([]string, 0, len(failed))
+		for groupVersion := range failed {
+			groupVersions = append(groupVersions, groupVersion)
+		}
+		sort.Strings(groupVersions)
+		for _, groupVersion := range groupVersions {
+			lines = append(lines, prefix+groupVersion+": "+failed[groupVersion])
+		}
+	}
+	return lines
+}
@@ -0,0 +1,75 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestCmd_Run_DeletionBlockers(t *testing.T) {
+	t.Parallel()
+	deletionTimestamp := now.Add(-2 * time.Hour)
+	certificate := newResource("cert-manager.io/v1", "Certificate", "stuck", "web-tls")
+	certificate.Metadata.DeletionTimestamp = &deletionTimestamp
+	certificate.Metadata.Finalizers = []string{"cert-manager.io/cleanup", "example.com/audit"}
+	configMap := newResource("v1", "ConfigMap", "stuck", "settings")
+	discoveryFailure := &cmd.FetchError{Err: &kubectl.PartialDiscoveryError{
+		Message: "error: unable to retrieve the complete list of server APIs: metrics.k8s.io/v1beta1: the server is currently unable to handle the request",
+	}}
+
+	run := func(t *testing.T, fetcher *mockFetcher, options *cmd.Options) (string, string, error) {
+		t.Helper()
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		options.DeletionBlockers = true
+		c, err := cmd.NewCmd(fetcher, options, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+		c.Now = func() time.Time { return now }
+		err = c.Run(context.Background())
+		return stdout.builder.String(), stderr.String(), err
+	}
+
+	t.Run("reports the remaining resources and the failing aggregated APIs", func(t *testing.T) {
+		fetcher := &mockFetcher{
+			resources: []*kubectl.Resource{certificate, configMap},
+			err:       &cmd.PartialFetchError{Failures: []*cmd.FetchError{discoveryFailure}},
+		}
+
+		stdout, stderr, err := run(t, fetcher, &cmd.Options{})
+
+		assert.Nil(t, err)
+		expected := `NAME                                  DELETING   FINALIZERS
+certificate.cert-manager.io/web-tls   120m       cert-manager.io/cleanup,example.com/audit
+configmap/settings                    <none>     <none>
+
+Failing aggregated APIs:
+  metrics.k8s.io/v1beta1: the server is currently unable to handle the request
+`
+		assert.Equals(t, expected, stdout)
+		assert.Equals(t, "2 resources remain, 1 with finalizers.\n", stderr)
+	})
+
+	t.Run("reports the other failures as usual", func(t *testing.T) {
+		fetcher := &mockFetcher{
+			err: &cmd.PartialFetchError{Failures: []*cmd.FetchError{
+				{Cluster: "prod", Err: discoveryFailure.Err},
+				{Cluster: "prod", Kind: "secrets", Err: errors.New("forbidden")},
+			}},
+		}
+
+		stdout, stderr, err := run(t, fetcher, &cmd.Options{Contexts: []string{"prod"}})
+
+		var partialErr *cmd.PartialFetchError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equals(t, 1, len(partialErr.Failures))
+		assert.Equals(t, "Failing aggregated APIs:\n  [prod] metrics.k8s.io/v1beta1: the server is currently unable to handle the request\n", stdout)
+		assert.Contains(t, stderr, "No resources remain.\n")
+		assert.Contains(t, stderr, "forbidden")
+	})
+}
@@ -3,23 +3,32 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
-	"strings"
 	"sync"
 	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
 )
 
 // Fetcher is an interface for cmd.Plugin
 type Fetcher interface {
-	Fetch(ctx context.Context) ([]string, error)
+	Fetch(ctx context.Context) ([]*kubectl.Resource, error)
+	Stream(ctx context.Context, batches chan<- []*kubectl.Resource) error
+	Watch(ctx context.Context, events chan<- *WatchEvent) error
+	// SkippedKinds returns the number of kinds that the last fetch didn't
+	// fetch since matches were found in their cluster with find
+	SkippedKinds() int
 }
 
 // Starter is an interface for terminal.UI
 type Starter interface {
 	Start(ctx context.Context, wg *sync.WaitGroup)
+	Feed(ctx context.Context, wg *sync.WaitGroup, events <-chan *terminal.WatchEvent)
 }
 
 // Stdout is an interface for os.Stdout
@@ -29,28 +38,69 @@ type Stdout interface {
 }
 
 type Cmd struct {
+	options       *Options
 	plugin        Fetcher
 	stderr        io.Writer
 	stdout        Stdout
 	ui            Starter
 	UIStopTimeout time.Duration
+	// Now returns the current time, it's used to compute the age of the
+	// resources
+	Now func() time.Time
 }
 
-func NewCmd(plugin Fetcher, stdout Stdout, stderr io.Writer, ui Starter) (*Cmd, error) {
+func NewCmd(plugin Fetcher, options *Options, stdout Stdout, stderr io.Writer, ui Starter) (*Cmd, error) {
 	return &Cmd{
+		options:       options,
 		plugin:        plugin,
 		stderr:        stderr,
 		stdout:        stdout,
 		ui:            ui,
 		UIStopTimeout: 500 * time.Millisecond,
+		Now:           time.Now,
 	}, nil
 }
 
 func (c *Cmd) Run(ctx context.Context) error {
+	if c.options.Command == CommandDiff {
+		return c.diff(ctx)
+	}
+	if c.options.Stream {
+		return c.stream(ctx)
+	}
+	if c.options.Watch {
+		return c.watch(ctx)
+	}
+	resources, partialErr, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.options.Export != "":
+		err = c.export(resources)
+	case c.options.Orphans:
+		err = c.printOrphans(resources, partialErr)
+	case c.options.DeletionBlockers:
+		return c.printDeletionBlockers(resources, partialErr)
+	case c.options.Command == CommandFind:
+		err = c.printFound(resources)
+	default:
+		err = c.printResources(resources)
+	}
+	if err != nil {
+		return err
+	}
+	return c.reportPartialFailure(partialErr)
+}
+
+// fetch fetches the resources while displaying the progress UI. The
+// partial failure error is returned separately since the resources that
+// could be fetched are still usable.
+func (c *Cmd) fetch(ctx context.Context) ([]*kubectl.Resource, *PartialFetchError, error) {
 	wg := &sync.WaitGroup{}
 	fileInfo, err := c.stdout.Stat()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	uiCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -62,18 +112,131 @@ func (c *Cmd) Run(ctx context.Context) error {
 	resources, err := c.plugin.Fetch(ctx)
 	cancel()
 	c.waitForUI(wg)
-	if err != nil {
+	var partialErr *PartialFetchError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, nil, err
+	}
+	return resources, partialErr, nil
+}
+
+// stream prints the resources of each kind as soon as they are fetched. The
+// progress UI isn't displayed since it would hide the resources.
+func (c *Cmd) stream(ctx context.Context) error {
+	batches := make(chan []*kubectl.Resource)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- c.plugin.Stream(ctx, batches)
+	}()
+	bufferedStdout := bufio.NewWriter(c.stdout)
+	var found bool
+	var printErr error
+	for batch := range batches {
+		if printErr != nil {
+			// keep receiving so that Stream can return
+			continue
+		}
+		if found && c.options.Output == OutputWide {
+			fmt.Fprintln(bufferedStdout)
+		}
+		found = true
+		if printErr = c.writeResources(bufferedStdout, batch); printErr == nil {
+			printErr = bufferedStdout.Flush()
+		}
+	}
+	err := <-streamErr
+	if printErr != nil {
+		return printErr
+	}
+	var partialErr *PartialFetchError
+	if err != nil && !errors.As(err, &partialErr) {
 		return err
 	}
-	if len(resources) == 0 {
+	if !found {
 		fmt.Fprintln(c.stderr, "No resources found.")
+	}
+	return c.reportPartialFailure(partialErr)
+}
+
+// reportPartialFailure prints the summary of the failures, if any, and
+// returns the partial failure error.
+func (c *Cmd) reportPartialFailure(partialErr *PartialFetchError) error {
+	if partialErr == nil {
 		return nil
 	}
+	fmt.Fprintln(c.stderr, "\nSome resources could not be fetched:")
+	partialErr.PrintSummary(c.stderr)
+	return partialErr
+}
+
+func (c *Cmd) printResources(resources []*kubectl.Resource) error {
+	if len(resources) == 0 {
+		fmt.Fprintln(c.stderr, "No resources found.")
+		// json and yaml still need an empty document, csv and markdown the
+		// header of their table and the templates are applied to an empty
+		// list, like kubectl does
+		switch c.options.Output {
+		case OutputJSON, OutputYAML, OutputCSV, OutputMarkdown, OutputGoTemplate, OutputJSONPath:
+		default:
+			return nil
+		}
+	}
 	bufferedStdout := bufio.NewWriter(c.stdout)
-	bufferedStdout.WriteString(strings.Join(resources, "\n") + "\n")
+	if err := c.writeResources(bufferedStdout, resources); err != nil {
+		return err
+	}
 	return bufferedStdout.Flush()
 }
 
+// writeResources writes the resources in the requested output format.
+func (c *Cmd) writeResources(w io.Writer, resources []*kubectl.Resource) error {
+	switch c.options.Output {
+	case OutputJSON:
+		return printJSON(w, resources)
+	case OutputNDJSON:
+		return printNDJSON(w, resources)
+	case OutputYAML:
+		return printYAML(w, resources)
+	case OutputWide:
+		return printWide(w, resources, c.options, c.Now())
+	case OutputTree:
+		return c.printTree(w, resources)
+	case OutputSummary:
+		return printSummary(w, resources, c.options)
+	case OutputCSV:
+		return printCSV(w, resources, c.Now())
+	case OutputMarkdown:
+		return printMarkdown(w, resources, c.Now())
+	case OutputGoTemplate:
+		return printGoTemplate(w, resources, c.options.Template)
+	case OutputJSONPath:
+		return printJSONPath(w, resources, c.options.Template)
+	default:
+		for _, resource := range resources {
+			if _, err := io.WriteString(w, c.formatName(resource)+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// formatName returns the resource in the `kubectl get -o name` format,
+// prefixed by its namespace when fetching from more than one namespace or
+// when cluster-scoped resources are mixed with namespaced ones.
+// Cluster-scoped resources never have a namespace prefix, which sets them
+// apart. When fetching from many contexts, the context is prefixed between
+// brackets.
+func (c *Cmd) formatName(resource *kubectl.Resource) string {
+	name := resource.String()
+	if c.options.showNamespaces() && resource.Namespace() != "" {
+		name = resource.Namespace() + "/" + name
+	}
+	if c.options.multiCluster() {
+		name = "[" + resource.Cluster + "] " + name
+	}
+	return name
+}
+
 func (c *Cmd) waitForUI(wg *sync.WaitGroup) {
 	stopped := make(chan struct{})
 	go func() {
@@ -2,6 +2,7 @@ package cmd_test
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"strings"
 	"sync"
@@ -9,23 +10,64 @@ import (
 	"time"
 
 	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
 )
 
 var cmdNamespacedResources string
 
-type mockFetcher struct{
-	err error
-	resources []string
+type mockFetcher struct {
+	err       error
+	resources []*kubectl.Resource
+	// batches are sent by Stream
+	batches [][]*kubectl.Resource
+	// events are sent by Watch
+	events []*cmd.WatchEvent
+	// skippedKinds is returned by SkippedKinds
+	skippedKinds int
 }
 
-func (m *mockFetcher) Fetch(ctx context.Context) ([]string, error) {
+func (m *mockFetcher) Fetch(ctx context.Context) ([]*kubectl.Resource, error) {
 	return m.resources, m.err
 }
 
+func (m *mockFetcher) Stream(ctx context.Context, batches chan<- []*kubectl.Resource) error {
+	defer close(batches)
+	for _, batch := range m.batches {
+		batches <- batch
+	}
+	return m.err
+}
+
+func (m *mockFetcher) Watch(ctx context.Context, events chan<- *cmd.WatchEvent) error {
+	defer close(events)
+	for _, event := range m.events {
+		events <- event
+	}
+	return nil
+}
+
+func (m *mockFetcher) SkippedKinds() int {
+	return m.skippedKinds
+}
+
+func newResource(apiVersion, kind, namespace, name string) *kubectl.Resource {
+	return &kubectl.Resource{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Metadata: kubectl.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+}
+
 type mockStarter struct {
 	calls              int
 	ungracefulShutdown bool
+	// feed receives the events displayed by Feed
+	feed []*terminal.WatchEvent
 }
 
 func (m *mockStarter) Start(ctx context.Context, wg *sync.WaitGroup) {
@@ -35,6 +77,13 @@ func (m *mockStarter) Start(ctx context.Context, wg *sync.WaitGroup) {
 	}
 }
 
+func (m *mockStarter) Feed(ctx context.Context, wg *sync.WaitGroup, events <-chan *terminal.WatchEvent) {
+	defer wg.Done()
+	for event := range events {
+		m.feed = append(m.feed, event)
+	}
+}
+
 type mockFileInfo struct {
 	mode fs.FileMode
 }
@@ -79,17 +128,185 @@ func (m *mockStdout) Stat() (fs.FileInfo, error) {
 func TestCmd_Run(t *testing.T) {
 	t.Parallel()
 	t.Run("works", func(t *testing.T) {
-		plugin := &mockFetcher{resources: []string{"deployment/foo"}}
+		plugin := &mockFetcher{resources: []*kubectl.Resource{
+			newResource("apps/v1", "Deployment", "default", "foo"),
+		}}
 		ui := &mockStarter{}
 		var stderr strings.Builder
 		stdout := &mockStdout{}
 		stdout.fileInfo.mode = fs.ModeCharDevice
-		cmd, err := cmd.NewCmd(plugin, stdout, &stderr, ui)
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{}, stdout, &stderr, ui)
 		assert.Nil(t, err)
 		err = cmd.Run(context.Background())
 		assert.Nil(t, err)
 		assert.Equals(t, 1, ui.calls)
-		assert.Contains(t, stdout.builder.String(), "deployment/foo")
+		assert.Equals(t, "deployment.apps/foo\n", stdout.builder.String())
+	})
+
+	t.Run("prefixes resources with their namespace when fetching across all namespaces", func(t *testing.T) {
+		plugin := &mockFetcher{resources: []*kubectl.Resource{
+			newResource("v1", "Service", "default", "kubernetes"),
+			newResource("apps/v1", "Deployment", "kube-system", "coredns"),
+		}}
+		var stderr strings.Builder
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{AllNamespaces: true}, stdout, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, "default/service/kubernetes\nkube-system/deployment.apps/coredns\n", stdout.builder.String())
+	})
+
+	t.Run("prefixes resources with their namespace when fetching from many namespaces", func(t *testing.T) {
+		plugin := &mockFetcher{resources: []*kubectl.Resource{
+			newResource("v1", "Service", "a", "foo"),
+			newResource("v1", "Service", "b", "bar"),
+		}}
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{Namespaces: []string{"a", "b"}}, stdout, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, "a/service/foo\nb/service/bar\n", stdout.builder.String())
+	})
+
+	t.Run("prefixes resources with their context when fetching from many contexts", func(t *testing.T) {
+		foo := newResource("v1", "Service", "default", "foo")
+		foo.Cluster = "prod"
+		plugin := &mockFetcher{resources: []*kubectl.Resource{foo}}
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{Contexts: []string{"prod"}}, stdout, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, "[prod] service/foo\n", stdout.builder.String())
+	})
+
+	t.Run("lists cluster-scoped resources without a namespace prefix", func(t *testing.T) {
+		plugin := &mockFetcher{resources: []*kubectl.Resource{
+			newResource("rbac.authorization.k8s.io/v1", "ClusterRole", "", "admin"),
+			newResource("v1", "ConfigMap", "default", "foo"),
+		}}
+		var stderr strings.Builder
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{IncludeNonNamespaced: true}, stdout, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, "clusterrole.rbac.authorization.k8s.io/admin\ndefault/configmap/foo\n", stdout.builder.String())
+	})
+
+	t.Run("prints the resources and a summary of the failures on partial success", func(t *testing.T) {
+		partialErr := &cmd.PartialFetchError{Failures: []*cmd.FetchError{
+			{Kind: "podmetrics.metrics.k8s.io", Err: errors.New("could not run kubectl command:\nserver unavailable")},
+		}}
+		plugin := &mockFetcher{
+			resources: []*kubectl.Resource{newResource("v1", "ConfigMap", "default", "foo")},
+			err:       partialErr,
+		}
+		var stderr strings.Builder
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{KeepGoing: true}, stdout, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.True(t, err == partialErr)
+		assert.Equals(t, "configmap/foo\n", stdout.builder.String())
+		assert.Contains(t, stderr.String(), "KIND                       ERROR")
+		assert.Contains(t, stderr.String(), "podmetrics.metrics.k8s.io  could not run kubectl command: server unavailable")
+	})
+
+	t.Run("structured output formats", func(t *testing.T) {
+		foo := newResource("apps/v1", "Deployment", "default", "foo")
+		foo.Resource = "deployments"
+		bar := newResource("rbac.authorization.k8s.io/v1", "ClusterRole", "", "bar")
+		bar.Resource = "clusterroles"
+		bar.Cluster = "prod"
+		testCases := []struct {
+			output   string
+			expected string
+		}{
+			{cmd.OutputJSON, `[
+  {
+    "group": "apps",
+    "version": "v1",
+    "kind": "Deployment",
+    "resource": "deployments",
+    "namespace": "default",
+    "name": "foo"
+  },
+  {
+    "cluster": "prod",
+    "group": "rbac.authorization.k8s.io",
+    "version": "v1",
+    "kind": "ClusterRole",
+    "resource": "clusterroles",
+    "name": "bar"
+  }
+]
+`},
+			{cmd.OutputNDJSON, `{"group":"apps","version":"v1","kind":"Deployment","resource":"deployments","namespace":"default","name":"foo"}
+{"cluster":"prod","group":"rbac.authorization.k8s.io","version":"v1","kind":"ClusterRole","resource":"clusterroles","name":"bar"}
+`},
+			{cmd.OutputYAML, `- group: apps
+  kind: Deployment
+  name: foo
+  namespace: default
+  resource: deployments
+  version: v1
+- cluster: prod
+  group: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: bar
+  resource: clusterroles
+  version: v1
+`},
+		}
+		for _, tc := range testCases {
+			plugin := &mockFetcher{resources: []*kubectl.Resource{foo, bar}}
+			stdout := &mockStdout{}
+			cmd, err := cmd.NewCmd(plugin, &cmd.Options{Output: tc.output}, stdout, &strings.Builder{}, &mockStarter{})
+			assert.Nil(t, err)
+			err = cmd.Run(context.Background())
+			assert.Nil(t, err)
+			assert.Equals(t, tc.expected, stdout.builder.String())
+		}
+	})
+
+	t.Run("prints an empty json array when no resources were found", func(t *testing.T) {
+		stdout := &mockStdout{}
+		cmd, err := cmd.NewCmd(&mockFetcher{}, &cmd.Options{Output: cmd.OutputJSON}, stdout, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, "[]\n", stdout.builder.String())
+	})
+
+	t.Run("streams the resources of each kind as they are fetched", func(t *testing.T) {
+		plugin := &mockFetcher{batches: [][]*kubectl.Resource{
+			{newResource("v1", "Service", "default", "a"), newResource("v1", "Service", "default", "b")},
+			{newResource("v1", "ConfigMap", "default", "c")},
+		}}
+		ui := &mockStarter{}
+		stdout := &mockStdout{}
+		stdout.fileInfo.mode = fs.ModeCharDevice
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{Stream: true}, stdout, &strings.Builder{}, ui)
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, 0, ui.calls)
+		assert.Equals(t, "service/a\nservice/b\nconfigmap/c\n", stdout.builder.String())
+	})
+
+	t.Run("reports partial failures after streaming", func(t *testing.T) {
+		partialErr := &cmd.PartialFetchError{Failures: []*cmd.FetchError{{Kind: "foos", Err: errors.New("boom")}}}
+		plugin := &mockFetcher{err: partialErr}
+		var stderr strings.Builder
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{Stream: true}, &mockStdout{}, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+		err = cmd.Run(context.Background())
+		assert.True(t, err == partialErr)
+		assert.Contains(t, stderr.String(), "No resources found.")
+		assert.Contains(t, stderr.String(), "foos  boom")
 	})
 
 	t.Run("displays a message to stderr when no resources were found", func(t *testing.T) {
@@ -97,7 +314,7 @@ func TestCmd_Run(t *testing.T) {
 		ui := &mockStarter{}
 		var stderr strings.Builder
 		stdout := &mockStdout{}
-		cmd, err := cmd.NewCmd(plugin, stdout, &stderr, ui)
+		cmd, err := cmd.NewCmd(plugin, &cmd.Options{}, stdout, &stderr, ui)
 		assert.Nil(t, err)
 		err = cmd.Run(context.Background())
 		assert.Nil(t, err)
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+// inventoryEntry is a resource of an inventory, along with its manifest when
+// the inventory has the manifests.
+type inventoryEntry struct {
+	record *Record
+	// manifest is the canonical JSON of the manifest without the fields
+	// populated by the API server, it's nil when it isn't available
+	manifest []byte
+}
+
+// inventory is a set of resources, indexed by inventoryKey.
+type inventory map[string]*inventoryEntry
+
+// add adds the resource to the inventory.
+func (i inventory) add(record *Record, manifest []byte) {
+	i[inventoryKey(record)] = &inventoryEntry{record: record, manifest: manifest}
+}
+
+// inventoryKey identifies a resource across inventories. The version isn't
+// part of the key since the same resource can be served by many versions.
+func inventoryKey(record *Record) string {
+	return strings.Join([]string{record.Cluster, record.Group, record.Kind, record.Namespace, record.Name}, "/")
+}
+
+// kindDiff contains the differences between two inventories for one kind.
+type kindDiff struct {
+	added   []*Record
+	removed []*Record
+	changed []*Record
+}
+
+// diff compares the resources found, or the NEW inventory, against the OLD
+// inventory.
+func (c *Cmd) diff(ctx context.Context) error {
+	old, err := loadInventory(c.options.DiffFiles[0])
+	if err != nil {
+		return err
+	}
+	var current inventory
+	var partialErr *PartialFetchError
+	if len(c.options.DiffFiles) > 1 {
+		if current, err = loadInventory(c.options.DiffFiles[1]); err != nil {
+			return err
+		}
+	} else {
+		var resources []*kubectl.Resource
+		if resources, partialErr, err = c.fetch(ctx); err != nil {
+			return err
+		}
+		if current, err = newLiveInventory(resources); err != nil {
+			return err
+		}
+	}
+	var failures []*FetchError
+	if partialErr != nil {
+		failures = partialErr.Failures
+	}
+	bufferedStdout := bufio.NewWriter(c.stdout)
+	added, removed, changed, err := printDiff(bufferedStdout, diffInventories(old, current, failures))
+	if err != nil {
+		return err
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return err
+	}
+	if added+removed+changed == 0 {
+		fmt.Fprintln(c.stderr, "No differences.")
+	} else {
+		fmt.Fprintf(c.stderr, "%d added, %d removed, %d changed\n", added, removed, changed)
+	}
+	return c.reportPartialFailure(partialErr)
+}
+
+// diffInventories returns the differences between the inventories, indexed
+// by kind. The resources of the kinds that couldn't be fetched aren't
+// reported as removed, since they are missing from the current inventory.
+func diffInventories(old, current inventory, failures []*FetchError) map[string]*kindDiff {
+	diffs := make(map[string]*kindDiff)
+	kindDiffOf := func(record *Record) *kindDiff {
+		kind := diffKindName(record)
+		if diffs[kind] == nil {
+			diffs[kind] = &kindDiff{}
+		}
+		return diffs[kind]
+	}
+	for key, entry := range current {
+		oldEntry, found := old[key]
+		switch {
+		case !found:
+			d := kindDiffOf(entry.record)
+			d.added = append(d.added, entry.record)
+		case oldEntry.manifest != nil && entry.manifest != nil && !bytes.Equal(oldEntry.manifest, entry.manifest):
+			d := kindDiffOf(entry.record)
+			d.changed = append(d.changed, entry.record)
+		}
+	}
+	for key, entry := range old {
+		if _, found := current[key]; !found && !kindFailed(failures, entry.record.Cluster, entry.record.Namespace, entry.record.Group, entry.record.Kind, entry.record.Resource) {
+			d := kindDiffOf(entry.record)
+			d.removed = append(d.removed, entry.record)
+		}
+	}
+	return diffs
+}
+
+// printDiff writes the differences of each kind, sorted by kind, and returns
+// the number of added, removed and changed resources.
+func printDiff(w io.Writer, diffs map[string]*kindDiff) (added, removed, changed int, err error) {
+	kinds := make([]string, 0, len(diffs))
+	for kind := range diffs {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		d := diffs[kind]
+		if _, err = fmt.Fprintln(w, kind); err != nil {
+			return
+		}
+		for _, section := range []struct {
+			marker  string
+			records []*Record
+		}{{"+", d.added}, {"-", d.removed}, {"~", d.changed}} {
+			sortRecords(section.records)
+			for _, record := range section.records {
+				if _, err = fmt.Fprintf(w, "  %s %s\n", section.marker, diffRecordName(record)); err != nil {
+					return
+				}
+			}
+		}
+		added += len(d.added)
+		removed += len(d.removed)
+		changed += len(d.changed)
+	}
+	return
+}
+
+// diffKindName returns the kind of the record in the `kubectl get -o name`
+// format, e.g. deployment.apps
+func diffKindName(record *Record) string {
+	kind := strings.ToLower(record.Kind)
+	if record.Group != "" {
+		kind += "." + record.Group
+	}
+	return kind
+}
+
+// diffRecordName returns the namespace and name of the record, prefixed by
+// its context between brackets when it has one.
+func diffRecordName(record *Record) string {
+	name := record.Name
+	if record.Namespace != "" {
+		name = record.Namespace + "/" + name
+	}
+	if record.Cluster != "" {
+		name = "[" + record.Cluster + "] " + name
+	}
+	return name
+}
+
+func sortRecords(records []*Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return diffRecordName(records[i]) < diffRecordName(records[j])
+	})
+}
+
+// comparableManifest returns the canonical JSON of the manifest, without the
+// fields that change on every update or that differ between versions.
+func comparableManifest(object map[string]any) ([]byte, error) {
+	stripServerFields(object)
+	delete(object, "apiVersion")
+	return json.Marshal(object)
+}
+
+// newLiveInventory returns the inventory of the resources that were just
+// fetched, with their manifests.
+func newLiveInventory(resources []*kubectl.Resource) (inventory, error) {
+	inv := make(inventory, len(resources))
+	for _, resource := range resources {
+		object, err := decodeManifest(resource)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s: %w", resource, err)
+		}
+		manifest, err := comparableManifest(object)
+		if err != nil {
+			return nil, err
+		}
+		inv.add(newRecord(resource), manifest)
+	}
+	return inv, nil
+}
+
+// loadInventory loads the inventory saved at the given path, either a
+// directory written with --export or a file written with -o json, yaml or
+// ndjson.
+func loadInventory(path string) (inventory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadExportedInventory(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeRecords(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not read inventory %s: %w", path, err)
+	}
+	inv := make(inventory, len(records))
+	for _, record := range records {
+		inv.add(record, nil)
+	}
+	return inv, nil
+}
+
+// decodeRecords decodes the records of the json, yaml or ndjson outputs.
+func decodeRecords(data []byte) ([]*Record, error) {
+	data = bytes.TrimSpace(data)
+	var records []*Record
+	if bytes.HasPrefix(data, []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			record := &Record{}
+			if err := decoder.Decode(record); errors.Is(err, io.EOF) {
+				return records, nil
+			} else if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err := yaml.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// loadExportedInventory loads the manifests of a directory written with
+// --export. The manifests are in a directory per context when the top
+// directories have a contextFile.
+func loadExportedInventory(dir string) (inventory, error) {
+	inv := make(inventory)
+	root := filepath.Clean(dir)
+	var cluster string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filepath.Dir(path) == root {
+				cluster, err = readContextFile(path)
+			}
+			return err
+		}
+		if filepath.Ext(path) != ".yaml" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var object map[string]any
+		if err := yaml.Unmarshal(data, &object); err != nil {
+			return fmt.Errorf("could not read manifest %s: %w", path, err)
+		}
+		record := exportedRecord(object)
+		record.Cluster = cluster
+		manifest, err := comparableManifest(object)
+		if err != nil {
+			return err
+		}
+		inv.add(record, manifest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// readContextFile returns the name of the context of the manifests in the
+// directory, or an empty string when it isn't the directory of a context.
+func readContextFile(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, contextFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// exportedRecord returns the record of an exported manifest.
+func exportedRecord(object map[string]any) *Record {
+	resource := &kubectl.Resource{}
+	resource.APIVersion, _ = object["apiVersion"].(string)
+	resource.Kind, _ = object["kind"].(string)
+	if metadata, ok := object["metadata"].(map[string]any); ok {
+		resource.Metadata.Name, _ = metadata["name"].(string)
+		resource.Metadata.Namespace, _ = metadata["namespace"].(string)
+	}
+	return newRecord(resource)
+}
@@ -0,0 +1,191 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCmd_Run_Diff(t *testing.T) {
+	t.Parallel()
+	runDiff := func(t *testing.T, resources []*kubectl.Resource, files ...string) (string, string) {
+		t.Helper()
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		options := &cmd.Options{Command: cmd.CommandDiff, DiffFiles: files}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources}, options, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+		assert.Nil(t, c.Run(context.Background()))
+		return stdout.builder.String(), stderr.String()
+	}
+
+	t.Run("compares the resources found against a saved inventory", func(t *testing.T) {
+		old := writeFile(t, filepath.Join(t.TempDir(), "old.ndjson"), `{"group":"apps","version":"v1","kind":"Deployment","resource":"deployments","namespace":"default","name":"web"}
+{"group":"apps","version":"v1","kind":"Deployment","resource":"deployments","namespace":"default","name":"old"}
+{"group":"","version":"v1","kind":"ConfigMap","resource":"configmaps","namespace":"default","name":"settings"}
+`)
+		resources := []*kubectl.Resource{
+			newRawResource(t, "apps/v1", "Deployment", `{"metadata": {"name": "web", "namespace": "default"}, "spec": {"replicas": 3}}`),
+			newRawResource(t, "apps/v1", "Deployment", `{"metadata": {"name": "api", "namespace": "default"}}`),
+			newRawResource(t, "rbac.authorization.k8s.io/v1", "ClusterRole", `{"metadata": {"name": "admin"}}`),
+		}
+
+		stdout, stderr := runDiff(t, resources, old)
+
+		expected := `clusterrole.rbac.authorization.k8s.io
+  + admin
+configmap
+  - default/settings
+deployment.apps
+  + default/api
+  - default/old
+`
+		assert.Equals(t, expected, stdout)
+		assert.Equals(t, "2 added, 2 removed, 0 changed\n", stderr)
+	})
+
+	t.Run("doesn't report the resources of the kinds that couldn't be fetched as removed", func(t *testing.T) {
+		old := writeFile(t, filepath.Join(t.TempDir(), "old.ndjson"), `{"group":"apps","version":"v1","kind":"Deployment","resource":"deployments","namespace":"default","name":"old"}
+{"group":"","version":"v1","kind":"ConfigMap","resource":"configmaps","namespace":"default","name":"settings"}
+{"group":"","version":"v1","kind":"ConfigMap","resource":"configmaps","namespace":"other","name":"settings"}
+{"group":"networking.k8s.io","version":"v1","kind":"Ingress","namespace":"default","name":"web"}
+{"group":"metrics.k8s.io","version":"v1beta1","kind":"PodMetrics","resource":"pods","namespace":"default","name":"web-0"}
+`)
+		partialErr := &cmd.PartialFetchError{Failures: []*cmd.FetchError{
+			{Namespace: "default", Kind: "configmaps", Err: errors.New("forbidden")},
+			{Kind: "ingresses.networking.k8s.io", Err: errors.New("forbidden")},
+			{Err: &kubectl.PartialDiscoveryError{Message: "error: unable to retrieve the complete list of server APIs: metrics.k8s.io/v1beta1: the server is currently unable to handle the request"}},
+		}}
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		options := &cmd.Options{Command: cmd.CommandDiff, DiffFiles: []string{old}}
+		c, err := cmd.NewCmd(&mockFetcher{err: partialErr}, options, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.True(t, errors.As(err, &partialErr))
+		expected := `configmap
+  - other/settings
+deployment.apps
+  - default/old
+`
+		assert.Equals(t, expected, stdout.builder.String())
+		assert.Contains(t, stderr.String(), "0 added, 2 removed, 0 changed\n")
+	})
+
+	t.Run("reports the changed manifests of an exported inventory", func(t *testing.T) {
+		old := t.TempDir()
+		writeFile(t, filepath.Join(old, "default", "apps", "deployment", "web.yaml"), `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+  resourceVersion: "41"
+spec:
+  replicas: 2
+status:
+  readyReplicas: 1
+`)
+		writeFile(t, filepath.Join(old, "default", "apps", "deployment", "api.yaml"), `apiVersion: apps/v1beta1
+kind: Deployment
+metadata:
+  name: api
+  namespace: default
+spec:
+  replicas: 1
+`)
+		resources := []*kubectl.Resource{
+			newRawResource(t, "apps/v1", "Deployment", `{"metadata": {"name": "web", "namespace": "default", "resourceVersion": "42"}, "spec": {"replicas": 3}, "status": {"readyReplicas": 3}}`),
+			newRawResource(t, "apps/v1", "Deployment", `{"metadata": {"name": "api", "namespace": "default", "uid": "1234"}, "spec": {"replicas": 1}, "status": {"readyReplicas": 1}}`),
+		}
+
+		stdout, stderr := runDiff(t, resources, old)
+
+		assert.Equals(t, "deployment.apps\n  ~ default/web\n", stdout)
+		assert.Equals(t, "0 added, 0 removed, 1 changed\n", stderr)
+	})
+
+	t.Run("reads the contexts of an exported inventory from their context file", func(t *testing.T) {
+		old := t.TempDir()
+		resources := func() []*kubectl.Resource {
+			var resources []*kubectl.Resource
+			for _, kubeContext := range []string{"arn:aws:eks:us-east-1:123:cluster/prod", "staging"} {
+				configMap := newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`)
+				configMap.Cluster = kubeContext
+				resources = append(resources, configMap)
+			}
+			return resources
+		}
+		options := &cmd.Options{Export: old, Contexts: []string{"arn:aws:eks:us-east-1:123:cluster/prod", "staging"}}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources()}, options, &mockStdout{}, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+		assert.Nil(t, c.Run(context.Background()))
+
+		stdout, stderr := runDiff(t, resources(), old)
+
+		assert.Equals(t, "", stdout)
+		assert.Equals(t, "No differences.\n", stderr)
+	})
+
+	t.Run("compares two saved inventories", func(t *testing.T) {
+		dir := t.TempDir()
+		old := writeFile(t, filepath.Join(dir, "old.json"), `[
+  {"cluster": "prod", "group": "", "version": "v1", "kind": "Namespace", "resource": "namespaces", "name": "team-a"},
+  {"cluster": "prod", "group": "", "version": "v1", "kind": "Namespace", "resource": "namespaces", "name": "team-b"}
+]
+`)
+		current := writeFile(t, filepath.Join(dir, "new.yaml"), `- cluster: prod
+  group: ""
+  version: v1
+  kind: Namespace
+  resource: namespaces
+  name: team-a
+- cluster: staging
+  group: ""
+  version: v1
+  kind: Namespace
+  resource: namespaces
+  name: team-a
+`)
+
+		stdout, stderr := runDiff(t, nil, old, current)
+
+		assert.Equals(t, "namespace\n  + [staging] team-a\n  - [prod] team-b\n", stdout)
+		assert.Equals(t, "1 added, 1 removed, 0 changed\n", stderr)
+	})
+
+	t.Run("reports when there are no differences", func(t *testing.T) {
+		old := writeFile(t, filepath.Join(t.TempDir(), "old.ndjson"), "")
+
+		stdout, stderr := runDiff(t, nil, old)
+
+		assert.Equals(t, "", stdout)
+		assert.Equals(t, "No differences.\n", stderr)
+	})
+
+	t.Run("returns an error when the inventory can't be read", func(t *testing.T) {
+		options := &cmd.Options{Command: cmd.CommandDiff, DiffFiles: []string{filepath.Join(t.TempDir(), "missing.json")}}
+		c, err := cmd.NewCmd(&mockFetcher{}, options, &mockStdout{}, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+		assert.NotNil(t, c.Run(context.Background()))
+	})
+}
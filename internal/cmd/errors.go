@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// FetchError is the failure to get the resources of a kind. When Kind is
+// empty, it's the failure to discover the API resources of a cluster.
+type FetchError struct {
+	Cluster   string
+	Namespace string
+	Kind      string
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// PartialFetchError is returned by Plugin.Fetch, along with the resources that
+// could be fetched, when running with --keep-going and some kinds couldn't be
+// fetched.
+type PartialFetchError struct {
+	Failures []*FetchError
+}
+
+func (e *PartialFetchError) Error() string {
+	return fmt.Sprintf("%d error(s) occurred, the results are incomplete", len(e.Failures))
+}
+
+// PrintSummary writes a table of the failures to `w`.
+func (e *PartialFetchError) PrintSummary(w io.Writer) error {
+	var showCluster, showNamespace bool
+	for _, failure := range e.Failures {
+		showCluster = showCluster || failure.Cluster != ""
+		showNamespace = showNamespace || failure.Namespace != ""
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	printRow := func(cluster, namespace, kind, err string) {
+		var columns []string
+		if showCluster {
+			columns = append(columns, cluster)
+		}
+		if showNamespace {
+			columns = append(columns, namespace)
+		}
+		columns = append(columns, kind, err)
+		fmt.Fprintln(table, strings.Join(columns, "\t"))
+	}
+	printRow("CONTEXT", "NAMESPACE", "KIND", "ERROR")
+	for _, failure := range e.Failures {
+		kind := failure.Kind
+		if kind == "" {
+			kind = "(discovery)"
+		}
+		// kubectl errors span many lines, keep them on a single row
+		err := strings.Join(strings.Fields(failure.Err.Error()), " ")
+		printRow(failure.Cluster, failure.Namespace, kind, err)
+	}
+	return table.Flush()
+}
+
+// kindFailed returns true if the resources of a kind, in the given cluster and
+// namespace, couldn't all be fetched, including when its API group couldn't
+// be discovered. The kind is identified by its API group and API resource,
+// e.g. ingresses, or by its kind, e.g. Ingress, when the API resource isn't
+// known.
+func kindFailed(failures []*FetchError, cluster, namespace, group, kind, resource string) bool {
+	for _, failure := range failures {
+		if failure.Cluster != cluster || (failure.Namespace != "" && failure.Namespace != namespace) {
+			continue
+		}
+		if failure.Kind == "" {
+			var partialErr *kubectl.PartialDiscoveryError
+			if !errors.As(failure.Err, &partialErr) {
+				// none of the kinds of the cluster were discovered
+				return true
+			}
+			for groupVersion := range partialErr.FailedGroupVersions() {
+				if failedGroup, _, _ := strings.Cut(groupVersion, "/"); failedGroup == group {
+					return true
+				}
+			}
+			continue
+		}
+		failedResource, failedGroup := splitKind(failure.Kind)
+		if failedGroup != group {
+			continue
+		}
+		if resource != "" && failedResource == resource || resource == "" && kindIsResource(kind, failedResource) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+// serverMetadataFields are the metadata fields populated by the API server,
+// they are stripped along with the status so that the manifests can be
+// applied again.
+var serverMetadataFields = []string{"creationTimestamp", "generation", "managedFields", "ownerReferences", "resourceVersion", "selfLink", "uid"}
+
+// lastAppliedAnnotation is the annotation written by kubectl apply, it's
+// stripped since it's a copy of the manifest.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// contextFile is the file, in the directory of each context of an export,
+// that has the name of the context, which diff reads since the name of the
+// directory is escaped.
+const contextFile = ".context"
+
+// export writes the manifest of each resource to its own file in the export
+// directory.
+func (c *Cmd) export(resources []*kubectl.Resource) error {
+	contexts := make(map[string]bool)
+	for _, resource := range resources {
+		manifest, err := exportManifest(resource, c.options.StripServerFields)
+		if err != nil {
+			return fmt.Errorf("could not export %s: %w", resource, err)
+		}
+		rel := exportPath(resource, c.options.multiCluster())
+		if !isLocalPath(rel) {
+			return fmt.Errorf("could not export %s: %s is outside of the export directory", resource, rel)
+		}
+		path := filepath.Join(c.options.Export, rel)
+		// the manifests can contain secrets
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, manifest, 0o600); err != nil {
+			return err
+		}
+		if c.options.multiCluster() && !contexts[resource.Cluster] {
+			contexts[resource.Cluster] = true
+			path := filepath.Join(c.options.Export, contextDir(resource.Cluster), contextFile)
+			if err := os.WriteFile(path, []byte(resource.Cluster+"\n"), 0o600); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(c.stderr, "Exported %d resources to %s\n", len(resources), c.options.Export)
+	return nil
+}
+
+// exportPath returns the path of the manifest of the resource, relative to
+// the export directory: [<context>/]<namespace>/<group>/<kind>/<name>.yaml.
+// Cluster-scoped resources are in the _cluster directory instead of a
+// namespace and the core group is named core. The context is escaped by
+// contextDir, its name is in the contextFile of its directory.
+func exportPath(resource *kubectl.Resource, multiCluster bool) string {
+	namespace := resource.Namespace()
+	if namespace == "" {
+		namespace = "_cluster"
+	}
+	group := resource.Group()
+	if group == "" {
+		group = "core"
+	}
+	path := filepath.Join(namespace, group, strings.ToLower(resource.Kind), resource.Name()+".yaml")
+	if multiCluster {
+		path = filepath.Join(contextDir(resource.Cluster), path)
+	}
+	return path
+}
+
+// contextDir returns the name of the directory of the manifests of the
+// context. The characters that would split the name in many directories, or
+// that aren't valid on every platform, are percent-escaped, e.g. the / and :
+// of the ARNs of EKS contexts, and so is a leading dot so that the name is
+// never . or ..
+func contextDir(context string) string {
+	var b strings.Builder
+	for i := 0; i < len(context); i++ {
+		c := context[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte(`%/\:*?"<>|`, c) >= 0 || i == 0 && c == '.' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isLocalPath returns true if the relative path is within the directory it's
+// relative to.
+func isLocalPath(path string) bool {
+	path = filepath.Clean(path)
+	return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+// exportManifest returns the YAML manifest of the resource, without the
+// fields populated by the API server when `strip` is true.
+func exportManifest(resource *kubectl.Resource, strip bool) ([]byte, error) {
+	object, err := decodeManifest(resource)
+	if err != nil {
+		return nil, err
+	}
+	if strip {
+		stripServerFields(object)
+	}
+	return yaml.Marshal(object)
+}
+
+// decodeManifest returns the whole object of the resource.
+func decodeManifest(resource *kubectl.Resource) (map[string]any, error) {
+	raw := []byte(resource.Raw)
+	if len(raw) == 0 {
+		var err error
+		if raw, err = json.Marshal(resource); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	// the items of the lists returned by the API server have no apiVersion
+	// nor kind
+	object["apiVersion"] = resource.APIVersion
+	object["kind"] = resource.Kind
+	return object, nil
+}
+
+// stripServerFields removes the status and the metadata populated by the API
+// server from the object, along with the owner references, whose uids are
+// those of the owners in the cluster, and the last applied configuration.
+func stripServerFields(object map[string]any) {
+	delete(object, "status")
+	if metadata, ok := object["metadata"].(map[string]any); ok {
+		for _, field := range serverMetadataFields {
+			delete(metadata, field)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]any); ok {
+			delete(annotations, lastAppliedAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+}
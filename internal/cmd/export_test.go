@@ -0,0 +1,162 @@
+package cmd_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+// newRawResource decodes the resource like the KubeClient does, the
+// apiVersion and kind are set after decoding since the items of the lists
+// returned by the API server don't have them.
+func newRawResource(t *testing.T, apiVersion, kind, object string) *kubectl.Resource {
+	t.Helper()
+	resource, err := kubectl.DecodeResource([]byte(object), true)
+	assert.Nil(t, err)
+	resource.APIVersion = apiVersion
+	resource.Kind = kind
+	return resource
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestCmd_Run_Export(t *testing.T) {
+	t.Parallel()
+	deployment := `{
+		"metadata": {
+			"name": "web",
+			"namespace": "default",
+			"uid": "1234",
+			"resourceVersion": "42",
+			"generation": 3,
+			"creationTimestamp": "2022-06-15T12:00:00Z",
+			"managedFields": [{"manager": "kubectl"}],
+			"labels": {"app": "web"},
+			"annotations": {
+				"deployment.kubernetes.io/revision": "3",
+				"kubectl.kubernetes.io/last-applied-configuration": "{\"kind\":\"Deployment\"}"
+			},
+			"ownerReferences": [{"apiVersion": "example.com/v1", "kind": "App", "name": "shop", "uid": "9"}]
+		},
+		"spec": {"replicas": 2},
+		"status": {"readyReplicas": 2}
+	}`
+	clusterRole := `{"metadata": {"name": "system:admin"}, "rules": []}`
+
+	t.Run("writes a manifest per resource", func(t *testing.T) {
+		dir := t.TempDir()
+		stderr := &strings.Builder{}
+		resources := []*kubectl.Resource{
+			newRawResource(t, "apps/v1", "Deployment", deployment),
+			newRawResource(t, "rbac.authorization.k8s.io/v1", "ClusterRole", clusterRole),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}, "data": {"a": "b"}}`),
+		}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources}, &cmd.Options{Export: dir}, &mockStdout{}, stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, "Exported 3 resources to "+dir+"\n", stderr.String())
+		expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    deployment.kubernetes.io/revision: "3"
+    kubectl.kubernetes.io/last-applied-configuration: "{\"kind\":\"Deployment\"}"
+  creationTimestamp: "2022-06-15T12:00:00Z"
+  generation: 3
+  labels:
+    app: web
+  managedFields:
+  - manager: kubectl
+  name: web
+  namespace: default
+  ownerReferences:
+  - apiVersion: example.com/v1
+    kind: App
+    name: shop
+    uid: "9"
+  resourceVersion: "42"
+  uid: "1234"
+spec:
+  replicas: 2
+status:
+  readyReplicas: 2
+`
+		assert.Equals(t, expected, readFile(t, filepath.Join(dir, "default", "apps", "deployment", "web.yaml")))
+		assert.Contains(t, readFile(t, filepath.Join(dir, "_cluster", "rbac.authorization.k8s.io", "clusterrole", "system:admin.yaml")), "kind: ClusterRole\n")
+		assert.Contains(t, readFile(t, filepath.Join(dir, "default", "core", "configmap", "settings.yaml")), "data:\n  a: b\n")
+	})
+
+	t.Run("strips the fields populated by the server", func(t *testing.T) {
+		dir := t.TempDir()
+		resources := []*kubectl.Resource{newRawResource(t, "apps/v1", "Deployment", deployment)}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources}, &cmd.Options{Export: dir, StripServerFields: true}, &mockStdout{}, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    deployment.kubernetes.io/revision: "3"
+  labels:
+    app: web
+  name: web
+  namespace: default
+spec:
+  replicas: 2
+`
+		assert.Equals(t, expected, readFile(t, filepath.Join(dir, "default", "apps", "deployment", "web.yaml")))
+	})
+
+	t.Run("writes the manifests of each context in their own directory", func(t *testing.T) {
+		dir := t.TempDir()
+		configMap := newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`)
+		configMap.Cluster = "prod"
+		options := &cmd.Options{Export: dir, Contexts: []string{"prod", "staging"}}
+		c, err := cmd.NewCmd(&mockFetcher{resources: []*kubectl.Resource{configMap}}, options, &mockStdout{}, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Contains(t, readFile(t, filepath.Join(dir, "prod", "default", "core", "configmap", "settings.yaml")), "name: settings\n")
+	})
+
+	t.Run("escapes the contexts to a single directory within the export directory", func(t *testing.T) {
+		dir := t.TempDir()
+		var resources []*kubectl.Resource
+		for _, kubeContext := range []string{"arn:aws:eks:us-east-1:123:cluster/prod", "..", "../x"} {
+			configMap := newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`)
+			configMap.Cluster = kubeContext
+			resources = append(resources, configMap)
+		}
+		options := &cmd.Options{Export: dir, Contexts: []string{"prod", "staging"}}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources}, options, &mockStdout{}, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		for _, contextDir := range []string{"arn%3Aaws%3Aeks%3Aus-east-1%3A123%3Acluster%2Fprod", "%2E.", "%2E.%2Fx"} {
+			assert.Contains(t, readFile(t, filepath.Join(dir, contextDir, "default", "core", "configmap", "settings.yaml")), "name: settings\n")
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// printFound writes the resources found by the find command in the selected
+// output format, followed by the kinds in which the name was found on
+// stderr. Since the kinds of a cluster aren't fetched once matches are found
+// in it, the name may exist in the kinds that were skipped.
+func (c *Cmd) printFound(resources []*kubectl.Resource) error {
+	if len(resources) == 0 {
+		fmt.Fprintf(c.stderr, "No resources named like %q found.\n", c.options.NamePattern)
+		return nil
+	}
+	bufferedStdout := bufio.NewWriter(c.stdout)
+	if err := c.writeResources(bufferedStdout, resources); err != nil {
+		return err
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return err
+	}
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		if kind := kindOf(resource); !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(c.stderr, "Found in %d kinds: %s\n", len(kinds), strings.Join(kinds, ", "))
+	if skipped := c.plugin.SkippedKinds(); skipped > 0 {
+		fmt.Fprintf(c.stderr, "%d kinds weren't searched once the name was found, it may exist in other kinds too.\n", skipped)
+	}
+	return nil
+}
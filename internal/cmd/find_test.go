@@ -0,0 +1,69 @@
+package cmd_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestCmd_Run_Find(t *testing.T) {
+	t.Parallel()
+	options := func() *cmd.Options {
+		return &cmd.Options{Command: cmd.CommandFind, NamePattern: regexp.MustCompile("^payments-db$"), AllNamespaces: true}
+	}
+
+	t.Run("reports the kinds in which the name was found", func(t *testing.T) {
+		plugin := &mockFetcher{resources: []*kubectl.Resource{
+			newResource("v1", "Secret", "payments", "payments-db"),
+			newResource("apps/v1", "StatefulSet", "payments", "payments-db"),
+			newResource("v1", "Service", "payments", "payments-db"),
+		}}
+		plugin.skippedKinds = 2
+		stdout := &mockStdout{}
+		var stderr strings.Builder
+		c, err := cmd.NewCmd(plugin, options(), stdout, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		expected := `payments/secret/payments-db
+payments/statefulset.apps/payments-db
+payments/service/payments-db
+`
+		assert.Equals(t, expected, stdout.builder.String())
+		expected = "Found in 3 kinds: secret, service, statefulset.apps\n" +
+			"2 kinds weren't searched once the name was found, it may exist in other kinds too.\n"
+		assert.Equals(t, expected, stderr.String())
+	})
+
+	t.Run("doesn't warn about the kinds that weren't searched when every kind was", func(t *testing.T) {
+		plugin := &mockFetcher{resources: []*kubectl.Resource{newResource("v1", "Secret", "payments", "payments-db")}}
+		var stderr strings.Builder
+		c, err := cmd.NewCmd(plugin, options(), &mockStdout{}, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, "Found in 1 kinds: secret\n", stderr.String())
+	})
+
+	t.Run("reports that the name wasn't found", func(t *testing.T) {
+		stdout := &mockStdout{}
+		var stderr strings.Builder
+		c, err := cmd.NewCmd(&mockFetcher{}, options(), stdout, &stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, "", stdout.builder.String())
+		assert.Equals(t, "No resources named like \"^payments-db$\" found.\n", stderr.String())
+	})
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultIgnoredKinds are the kinds that aren't fetched unless
+// --include-events is given, there are usually lots of events and they are
+// short-lived.
+var DefaultIgnoredKinds = []string{"events", "events.events.k8s.io"}
+
+// builtinGroups are the API groups served by Kubernetes itself, the kinds of
+// the other API groups are custom resources.
+var builtinGroups = map[string]bool{
+	"":                             true,
+	"admissionregistration.k8s.io": true,
+	"apiextensions.k8s.io":         true,
+	"apiregistration.k8s.io":       true,
+	"apps":                         true,
+	"authentication.k8s.io":        true,
+	"authorization.k8s.io":         true,
+	"autoscaling":                  true,
+	"batch":                        true,
+	"certificates.k8s.io":          true,
+	"coordination.k8s.io":          true,
+	"discovery.k8s.io":             true,
+	"events.k8s.io":                true,
+	"flowcontrol.apiserver.k8s.io": true,
+	"internal.apiserver.k8s.io":    true,
+	"metrics.k8s.io":               true,
+	"networking.k8s.io":            true,
+	"node.k8s.io":                  true,
+	"policy":                       true,
+	"rbac.authorization.k8s.io":    true,
+	"resource.k8s.io":              true,
+	"scheduling.k8s.io":            true,
+	"storage.k8s.io":               true,
+	"storagemigration.k8s.io":      true,
+}
+
+// kindGroups are the named groups of kinds that can be given to --kinds. They
+// are resolved against the discovered kinds, using the resource name and the
+// API group of each kind.
+var kindGroups = map[string]func(resource, group string) bool{
+	"workloads": func(resource, group string) bool {
+		switch group {
+		case "":
+			return resource == "pods" || resource == "replicationcontrollers"
+		case "apps":
+			return resource != "controllerrevisions"
+		case "batch", "autoscaling":
+			return true
+		}
+		return false
+	},
+	"networking": func(resource, group string) bool {
+		switch group {
+		case "":
+			return resource == "services" || resource == "endpoints"
+		case "discovery.k8s.io", "networking.k8s.io", "gateway.networking.k8s.io":
+			return true
+		}
+		return false
+	},
+	"rbac": func(resource, group string) bool {
+		return group == "rbac.authorization.k8s.io" || (group == "" && resource == "serviceaccounts")
+	},
+	"crds": func(resource, group string) bool {
+		return !builtinGroups[group]
+	},
+}
+
+// kindGroupNames returns the sorted names of the kind groups.
+func kindGroupNames() []string {
+	names := make([]string, 0, len(kindGroups))
+	for name := range kindGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// splitKind splits a kind as listed by `kubectl api-resources -o name`, e.g.
+// deployments.apps, into its resource name and API group.
+func splitKind(kind string) (resource, group string) {
+	resource, group, _ = strings.Cut(kind, ".")
+	return resource, group
+}
+
+// kindIsResource returns true if the API resource, e.g. ingresses, is the
+// plural of the kind, e.g. Ingress, for when the API resource of a kind isn't
+// known, e.g. in the manifests written with --export.
+func kindIsResource(kind, resource string) bool {
+	kind = strings.ToLower(kind)
+	switch {
+	case resource == kind, resource == kind+"s", resource == kind+"es":
+		return true
+	case strings.HasSuffix(kind, "y"):
+		return resource == strings.TrimSuffix(kind, "y")+"ies"
+	}
+	return false
+}
+
+// resolveKindName returns the discovered kinds that the name given to --kinds
+// refers to: the kinds of a named group, the kind with the given API group,
+// or, for a bare resource name, the kind of the core group, otherwise of the
+// builtin groups, otherwise the custom resources with that name. Like
+// kubectl, pods is the core kind and not also pods.metrics.k8s.io
+func resolveKindName(kinds []string, name string) []string {
+	var resolved []string
+	if inGroup, found := kindGroups[name]; found {
+		for _, kind := range kinds {
+			if resource, group := splitKind(kind); inGroup(resource, group) {
+				resolved = append(resolved, kind)
+			}
+		}
+		return resolved
+	}
+	if strings.Contains(name, ".") {
+		if contains(kinds, name) {
+			resolved = append(resolved, name)
+		}
+		return resolved
+	}
+	var builtin, custom []string
+	for _, kind := range kinds {
+		resource, group := splitKind(kind)
+		switch {
+		case resource != name:
+		case group == "":
+			resolved = append(resolved, kind)
+		case builtinGroups[group]:
+			builtin = append(builtin, kind)
+		default:
+			custom = append(custom, kind)
+		}
+	}
+	switch {
+	case len(resolved) > 0:
+		return resolved
+	case len(builtin) > 0:
+		return builtin
+	}
+	return custom
+}
+
+// resolveKindNames returns the set of the discovered kinds that the names
+// given to --kinds refer to.
+func resolveKindNames(kinds []string, names []string) map[string]bool {
+	resolved := make(map[string]bool)
+	for _, name := range names {
+		for _, kind := range resolveKindName(kinds, name) {
+			resolved[kind] = true
+		}
+	}
+	return resolved
+}
+
+// unknownKindNames returns the names given to --kinds, that aren't named
+// groups, which don't match any of the discovered kinds, e.g. the singular
+// pod instead of pods. The exclusions that match nothing are ignored, so that
+// the same command works on the clusters that don't serve the excluded kinds.
+func (o *Options) unknownKindNames(kinds []string) []string {
+	var unknown []string
+	for _, name := range o.Kinds {
+		if _, found := kindGroups[name]; !found && len(resolveKindName(kinds, name)) == 0 {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// namedExplicitly returns true if the pattern matches the whole kind, with or
+// without its API group, e.g. events but not the pattern '.', or if the kind
+// is the one named in the given set of kinds resolved from the names in
+// --kinds that aren't named groups.
+func (o *Options) namedExplicitly(kind string, named map[string]bool) bool {
+	if named[kind] {
+		return true
+	}
+	if o.Pattern == nil {
+		return false
+	}
+	resource, _ := splitKind(kind)
+	match := o.Pattern.FindString(kind)
+	return match == kind || match == resource
+}
+
+// filterKinds returns the discovered kinds that match the pattern and the
+// --kinds allow list, if any, and that aren't ignored or excluded by --exclude
+// or --kinds. The kinds ignored by default are still fetched when they're
+// named explicitly by --kinds or the pattern.
+func (o *Options) filterKinds(kinds []string) []string {
+	selected := resolveKindNames(kinds, o.Kinds)
+	excluded := resolveKindNames(kinds, o.ExcludedKinds)
+	var names []string
+	for _, name := range o.Kinds {
+		if _, found := kindGroups[name]; !found {
+			names = append(names, name)
+		}
+	}
+	named := resolveKindNames(kinds, names)
+	var filtered []string
+kinds:
+	for _, kind := range kinds {
+		if contains(o.IgnoredKinds, kind) && !(contains(DefaultIgnoredKinds, kind) && o.namedExplicitly(kind, named)) {
+			continue
+		}
+		if o.Pattern != nil && !o.Pattern.MatchString(kind) {
+			continue
+		}
+		for _, exclude := range o.Exclude {
+			if exclude.MatchString(kind) {
+				continue kinds
+			}
+		}
+		if len(o.Kinds) > 0 && !selected[kind] {
+			continue
+		}
+		if excluded[kind] {
+			continue
+		}
+		filtered = append(filtered, kind)
+	}
+	return filtered
+}
@@ -4,17 +4,193 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/discovery"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// Output formats
+const (
+	OutputCSV        = "csv"
+	OutputGoTemplate = "go-template"
+	OutputJSON       = "json"
+	OutputJSONPath   = "jsonpath"
+	OutputMarkdown   = "markdown"
+	OutputName       = "name"
+	OutputNDJSON     = "ndjson"
+	OutputSummary    = "summary"
+	OutputTree       = "tree"
+	OutputWide       = "wide"
+	OutputYAML       = "yaml"
+)
+
+// Backends, i.e. how the cluster is queried
+const (
+	BackendKubectl = "kubectl"
+	BackendREST    = "rest"
+)
+
+var backends = []string{BackendKubectl, BackendREST}
+
+// Subcommands
+const (
+	CommandDiff = "diff"
+	CommandFind = "find"
 )
 
+var outputFormats = []string{OutputName, OutputJSON, OutputYAML, OutputNDJSON, OutputWide, OutputTree, OutputSummary, OutputCSV, OutputMarkdown, OutputGoTemplate, OutputJSONPath}
+
+// templateOutputFormats are the output formats that take a template after an
+// equal sign, e.g. -o jsonpath={.items[*].name}
+var templateOutputFormats = []string{OutputGoTemplate, OutputJSONPath}
+
+// watchOutputFormats are the output formats whose lines can be followed by
+// the lines of the events of --watch.
+var watchOutputFormats = []string{OutputName, OutputWide, OutputNDJSON}
+
+// streamableOutputFormats are the output formats that can be written one kind
+// at a time.
+var streamableOutputFormats = []string{OutputName, OutputNDJSON, OutputWide}
+
 // Options contains the result of parsing
 // the command line options
 type Options struct {
 	AllNamespaces        bool
+	Backend              string
+	Command              string
+	ContextPattern       *regexp.Regexp
+	Contexts             []string
+	DeletionBlockers     bool
+	DiffFiles            []string
+	DiffManifests        bool
+	DiscoveryTTL         time.Duration
+	Exclude              []*regexp.Regexp
+	Export               string
+	ExcludedKinds        []string
+	FieldSelector        string
+	IgnoredKinds         []string
+	IncludeEvents        bool
 	IncludeNonNamespaced bool
+	KeepGoing            bool
+	Kinds                []string
+	LabelSelector        string
 	MaxInFlight          int
+	NamePattern          *regexp.Regexp
+	Namespaces           []string
+	NamespacePattern     *regexp.Regexp
+	NewerThan            time.Duration
+	OlderThan            time.Duration
+	Orphans              bool
+	Output               string
 	Pattern              *regexp.Regexp
+	RefreshDiscovery     bool
+	Stream               bool
+	StripServerFields    bool
+	Template             string
+	Watch                bool
+	WatchInterval        time.Duration
+
+	// kubectl global flags
+	As             string
+	AsGroups       []string
+	Cluster        string
+	Context        string
+	Kubeconfig     string
+	RequestTimeout string
+	User           string
+}
+
+// multiCluster returns true when fetching from many kubeconfig contexts.
+func (o *Options) multiCluster() bool {
+	return len(o.Contexts) > 0 || o.ContextPattern != nil
+}
+
+// KubectlFlags returns the kubectl global flags that must be passed to every
+// kubectl command.
+func (o *Options) KubectlFlags() []string {
+	var flags []string
+	addFlag := func(name, value string) {
+		if value != "" {
+			flags = append(flags, "--"+name+"="+value)
+		}
+	}
+	addFlag("kubeconfig", o.Kubeconfig)
+	addFlag("context", o.Context)
+	addFlag("cluster", o.Cluster)
+	addFlag("user", o.User)
+	addFlag("as", o.As)
+	for _, group := range o.AsGroups {
+		addFlag("as-group", group)
+	}
+	addFlag("request-timeout", o.RequestTimeout)
+	return flags
+}
+
+// showNamespaces returns true when the output can contain resources from
+// more than one namespace, or cluster-scoped resources.
+func (o *Options) showNamespaces() bool {
+	return o.AllNamespaces || o.IncludeNonNamespaced ||
+		len(o.Namespaces) > 1 || o.NamespacePattern != nil
+}
+
+// FullObjects returns true when the whole objects must be fetched instead of
+// only their metadata: to export them, to compare their manifests with the
+// exported ones and to find what references the orphans. The metadata listed
+// by the rest backend has no status, which the wide output shows.
+func (o *Options) FullObjects() bool {
+	return o.Export != "" || (o.Command == CommandDiff && o.DiffManifests) || o.Orphans ||
+		(o.Backend == BackendREST && o.Output == OutputWide)
+}
+
+// filterResources returns the resources whose name matches --name and
+// whose age, at `now`, is within --older-than and --newer-than, if any.
+func (o *Options) filterResources(resources []*kubectl.Resource, now time.Time) []*kubectl.Resource {
+	if o.NamePattern == nil && o.OlderThan == 0 && o.NewerThan == 0 {
+		return resources
+	}
+	var filtered []*kubectl.Resource
+	for _, resource := range resources {
+		if o.NamePattern != nil && !o.NamePattern.MatchString(resource.Name()) {
+			continue
+		}
+		age := now.Sub(resource.Metadata.CreationTimestamp)
+		if o.OlderThan != 0 && age <= o.OlderThan {
+			continue
+		}
+		if o.NewerThan != 0 && age >= o.NewerThan {
+			continue
+		}
+		filtered = append(filtered, resource)
+	}
+	return filtered
+}
+
+// parseAge parses a duration that can start with a number of days, which
+// time.ParseDuration doesn't support, e.g. 30d, 1.5d or 1d12h.
+func parseAge(value string) (time.Duration, error) {
+	var days time.Duration
+	if before, after, found := strings.Cut(value, "d"); found {
+		n, err := strconv.ParseFloat(before, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("invalid number of days in %q", value)
+		}
+		days = time.Duration(n * float64(24*time.Hour))
+		if after == "" {
+			return days, nil
+		}
+		value = after
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
 }
 
 // GetOptions returns a new Options populated with the parsed
@@ -22,21 +198,234 @@ type Options struct {
 // If `commandLineArgs` is nil, os.Args[1:] is used.
 func GetOptions(commandLineArgs []string) (*Options, error) {
 	options := new(Options)
+	if len(commandLineArgs) > 0 && (commandLineArgs[0] == CommandDiff || commandLineArgs[0] == CommandFind) {
+		options.Command = commandLineArgs[0]
+		commandLineArgs = commandLineArgs[1:]
+	}
 	commandLine := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
-	// commandLine.BoolVar(&options.AllNamespaces, "all-namespaces", false, "Get resources accross all namespaces")
-	// commandLine.BoolVar(&options.AllNamespaces, "A", false, "Alias for --all-namespaces")
-	commandLine.IntVar(&options.MaxInFlight, "parallel", 10, "Parallel calls to kubectl")
+	commandLine.BoolVar(&options.AllNamespaces, "all-namespaces", false, "Get resources accross all namespaces")
+	commandLine.BoolVar(&options.AllNamespaces, "A", false, "Alias for --all-namespaces")
+	commandLine.BoolVar(&options.IncludeNonNamespaced, "include-non-namespaced", false, "Also get cluster-scoped resources, e.g. clusterroles, persistentvolumes, etc.")
+	commandLine.BoolVar(&options.IncludeNonNamespaced, "N", false, "Alias for --include-non-namespaced")
+	namespaces := func(value string) error {
+		options.Namespaces = append(options.Namespaces, splitList(value)...)
+		return nil
+	}
+	commandLine.Func("namespace", "Comma-separated list of namespaces to get resources from, can be repeated", namespaces)
+	commandLine.Func("n", "Alias for --namespace", namespaces)
+	commandLine.Func("namespace-pattern", "Get resources from the namespaces that match this regex", func(value string) error {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("could not compile regex from namespace pattern %q: %w", value, err)
+		}
+		options.NamespacePattern = re
+		return nil
+	})
+	commandLine.Func("contexts", "Comma-separated list of kubeconfig contexts to get resources from concurrently, can be repeated", func(value string) error {
+		options.Contexts = append(options.Contexts, splitList(value)...)
+		return nil
+	})
+	commandLine.Func("context-pattern", "Get resources from the kubeconfig contexts that match this regex", func(value string) error {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("could not compile regex from context pattern %q: %w", value, err)
+		}
+		options.ContextPattern = re
+		return nil
+	})
+	commandLine.Func("exclude", "Don't get the kinds that match this regex, can be repeated", func(value string) error {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("could not compile regex from exclude pattern %q: %w", value, err)
+		}
+		options.Exclude = append(options.Exclude, re)
+		return nil
+	})
+	kindsUsage := "Comma-separated list of kinds or named groups of kinds to get, prefix an item with a dash to skip it instead, can be repeated. Kinds are plural resource names, with or without their API group, e.g. pods,deployments.apps, a kind without its group being the builtin one. Named groups: " + strings.Join(kindGroupNames(), ", ")
+	commandLine.Func("kinds", kindsUsage, func(value string) error {
+		for _, kind := range splitList(value) {
+			if excluded := strings.TrimPrefix(kind, "-"); excluded != kind {
+				options.ExcludedKinds = append(options.ExcludedKinds, strings.ToLower(excluded))
+			} else {
+				options.Kinds = append(options.Kinds, strings.ToLower(kind))
+			}
+		}
+		return nil
+	})
+	var ignoredKinds []string
+	commandLine.Func("ignore-kinds", "Comma-separated list of kinds to ignore on top of the default ones ("+strings.Join(DefaultIgnoredKinds, ", ")+"), can be repeated. Kinds are full names as listed by kubectl api-resources -o name, e.g. leases.coordination.k8s.io", func(value string) error {
+		ignoredKinds = append(ignoredKinds, splitList(value)...)
+		return nil
+	})
+	commandLine.Func("name", "Only keep the resources whose name matches this regex, whatever their kind", func(value string) error {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("could not compile regex from name pattern %q: %w", value, err)
+		}
+		options.NamePattern = re
+		return nil
+	})
+	commandLine.Func("older-than", "Only keep the resources created more than this long ago, e.g. 30d, 1.5d, 1d12h, 90m", func(value string) error {
+		d, err := parseAge(value)
+		options.OlderThan = d
+		return err
+	})
+	commandLine.Func("newer-than", "Only keep the resources created less than this long ago, e.g. 2h, 1d", func(value string) error {
+		d, err := parseAge(value)
+		options.NewerThan = d
+		return err
+	})
+	commandLine.BoolVar(&options.IncludeEvents, "include-events", false, "Also get the events, which are ignored by default unless they are named by --kinds or PATTERN, e.g. --kinds events")
+	commandLine.StringVar(&options.LabelSelector, "selector", "", "Label selector to filter the resources of every kind, e.g. app=payments")
+	commandLine.StringVar(&options.LabelSelector, "l", "", "Alias for --selector")
+	commandLine.StringVar(&options.FieldSelector, "field-selector", "", "Field selector to filter the resources of every kind, e.g. status.phase=Running. The kinds that don't support the field selector are skipped")
+	commandLine.BoolVar(&options.KeepGoing, "keep-going", false, "Don't stop at the first kind that can't be fetched, print the resources that could be fetched and a summary of the errors")
+	commandLine.BoolVar(&options.KeepGoing, "k", false, "Alias for --keep-going")
+	outputUsage := make([]string, 0, len(outputFormats))
+	for _, format := range outputFormats {
+		if contains(templateOutputFormats, format) {
+			format += "=TEMPLATE"
+		}
+		outputUsage = append(outputUsage, format)
+	}
+	commandLine.StringVar(&options.Output, "output", OutputName, "Output format, one of: "+strings.Join(outputUsage, ", ")+". The tree output nests the resources under their owners, following their ownerReferences, and the resources without owners under the Argo CD Application that tracks them by its app.kubernetes.io/instance label. The templates are applied to a list of the records of the json output, e.g. -o jsonpath='{range .items[*]}{.namespace}/{.name}{\"\\n\"}{end}'")
+	commandLine.StringVar(&options.Output, "o", OutputName, "Alias for --output")
+	commandLine.BoolVar(&options.Orphans, "orphans", false, "Instead of printing the resources, report the ones that are likely orphaned, grouped by reason: configmaps and secrets that aren't referenced, services without endpoints, persistent volume claims that aren't mounted and resources whose owners no longer exist. Every kind must be fetched, so it can't be used with a PATTERN, --kinds, --exclude, --ignore-kinds or selectors. The resources whose referencing kinds couldn't be fetched aren't reported")
+	commandLine.BoolVar(&options.DeletionBlockers, "deletion-blockers", false, "Instead of printing the resources, report what blocks the deletion of the namespaces: every remaining resource with its finalizers and deletion timestamp, and the aggregated APIs that can't be discovered. Implies --keep-going and --refresh-discovery")
+	commandLine.StringVar(&options.Export, "export", "", "Write the manifest of every resource found to `DIR`/<namespace>/<group>/<kind>/<name>.yaml instead of printing the resources. Cluster-scoped resources are in DIR/_cluster and, when fetching from many contexts, the manifests are in a directory per context")
+	commandLine.BoolVar(&options.StripServerFields, "strip-server-fields", false, "With --export, remove the status and the metadata populated by the server, e.g. uid, resourceVersion, managedFields, along with the owner references and the last applied configuration, so that the manifests can be applied again")
+	commandLine.BoolVar(&options.Stream, "stream", false, "Print the resources of each kind as soon as they are fetched instead of sorting all the resources first, the progress isn't displayed")
+	commandLine.BoolVar(&options.Stream, "s", false, "Alias for --stream")
+	commandLine.BoolVar(&options.Watch, "watch", false, "After printing the resources, keep running and report the resources created and deleted, by listing the kinds found again periodically, until interrupted. Only with -o "+strings.Join(watchOutputFormats, ", ")+", with ndjson each event is a record with an event field, either created or deleted")
+	commandLine.BoolVar(&options.Watch, "w", false, "Alias for --watch")
+	commandLine.DurationVar(&options.WatchInterval, "watch-interval", 10*time.Second, "How often the kinds are listed again with --watch")
+	commandLine.StringVar(&options.Backend, "backend", BackendKubectl, "How to query the clusters, one of: "+strings.Join(backends, ", ")+". The rest backend talks to the API servers directly instead of running kubectl for every kind, it supports the usual kubeconfig credentials but not the legacy auth providers")
+	commandLine.DurationVar(&options.DiscoveryTTL, "discovery-ttl", discovery.DefaultTTL, "How long the API resources of the clusters are cached by the kubectl backend, 0 disables the cache. The kinds added to a cluster during that time, e.g. new CRDs, aren't fetched until the cache expires or with --refresh-discovery, the kinds removed since are discovered again")
+	commandLine.BoolVar(&options.RefreshDiscovery, "refresh-discovery", false, "Discover the API resources of the clusters again instead of using the cached ones")
+	commandLine.IntVar(&options.MaxInFlight, "parallel", 10, "Parallel calls to kubectl, shared by all the contexts")
 	commandLine.IntVar(&options.MaxInFlight, "p", 10, "Alias for --parallel")
 
+	commandLine.StringVar(&options.As, "as", "", "Username to impersonate for the kubectl calls")
+	commandLine.Func("as-group", "Group to impersonate for the kubectl calls, can be repeated", func(value string) error {
+		options.AsGroups = append(options.AsGroups, value)
+		return nil
+	})
+	commandLine.StringVar(&options.Cluster, "cluster", "", "The name of the kubeconfig cluster to use")
+	commandLine.StringVar(&options.Context, "context", "", "The name of the kubeconfig context to use")
+	commandLine.StringVar(&options.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use")
+	commandLine.StringVar(&options.RequestTimeout, "request-timeout", "", "The length of time to wait before giving up on a single server request, e.g. 1s, 2m")
+	commandLine.StringVar(&options.User, "user", "", "The name of the kubeconfig user to use")
+
 	commandLine.Usage = func() {
 		fmt.Fprintln(os.Stderr, "USAGE: kubectl fetch [OPTIONS]... [PATTERN]")
-		fmt.Fprintln(os.Stderr, "\nwhere PATTERN is an optionnal regex used to limit the kubernetes kinds that are searched. For example, specifying the pattern 'istio' will limit the results to only the resource kinds that contains 'istio' e.g. gateways.networking.istio.io\n\nOptions:")
+		fmt.Fprintln(os.Stderr, "       kubectl fetch diff [OPTIONS]... OLD [NEW]")
+		fmt.Fprintln(os.Stderr, "       kubectl fetch find [OPTIONS]... NAME")
+		fmt.Fprintln(os.Stderr, "\nwhere PATTERN is an optionnal regex used to limit the kubernetes kinds that are searched. For example, specifying the pattern 'istio' will limit the results to only the resource kinds that contains 'istio' e.g. gateways.networking.istio.io\n\nWhen fetching from more than one namespace or when including non-namespaced resources, namespaced resources are prefixed by their namespace and cluster-scoped resources are listed first, without a namespace, e.g. clusterrole.rbac.authorization.k8s.io/admin\n\nWhen fetching from many contexts, resources are prefixed by their context between brackets, e.g. [prod] deployment.apps/foo\n\nThe diff command compares the resources found against the OLD inventory, or compares the OLD and NEW inventories, and reports the added, removed and changed resources of each kind. An inventory is a file written with -o json, yaml or ndjson, or a directory written with --export, whose manifests are compared to find the changed resources\n\nThe find command looks for the resources whose name matches the NAME regex, whatever their kind, and reports the kinds in which the name was found. It stops fetching the kinds of a context once matches are found in it, the kinds being fetched at that time are still searched, so the name may exist in other kinds too\n\nOptions:")
 		commandLine.PrintDefaults()
 	}
 
 	commandLine.Parse(commandLineArgs)
 
+	if !options.IncludeEvents {
+		options.IgnoredKinds = append(options.IgnoredKinds, DefaultIgnoredKinds...)
+	}
+	options.IgnoredKinds = append(options.IgnoredKinds, ignoredKinds...)
+	if options.DeletionBlockers {
+		// the kinds that can't be fetched are part of the report
+		options.KeepGoing = true
+		// the aggregated APIs that can't be discovered are only known when
+		// discovering the API resources, not from the cache
+		options.RefreshDiscovery = true
+	}
+
+	if !contains(backends, options.Backend) {
+		return nil, fmt.Errorf("unknown backend %q, must be one of: %s", options.Backend, strings.Join(backends, ", "))
+	}
+	if format, template, found := strings.Cut(options.Output, "="); found && contains(templateOutputFormats, format) {
+		options.Output, options.Template = format, template
+	}
+	if !contains(outputFormats, options.Output) {
+		return nil, fmt.Errorf("unknown output format %q, must be one of: %s", options.Output, strings.Join(outputFormats, ", "))
+	}
+	if contains(templateOutputFormats, options.Output) {
+		if err := validateTemplate(options.Output, options.Template); err != nil {
+			return nil, err
+		}
+	}
+	if options.Stream && !contains(streamableOutputFormats, options.Output) {
+		return nil, fmt.Errorf("--stream only supports the following output formats: %s", strings.Join(streamableOutputFormats, ", "))
+	}
+	if options.Export != "" && options.Stream {
+		return nil, errors.New("--export can't be used with --stream")
+	}
+	if options.StripServerFields && options.Export == "" {
+		return nil, errors.New("--strip-server-fields can only be used with --export")
+	}
+	if options.DeletionBlockers && (options.Export != "" || options.Stream || options.Watch || options.Orphans) {
+		return nil, errors.New("--deletion-blockers can't be used with --export, --stream, --watch or --orphans")
+	}
+	if options.DeletionBlockers && options.IncludeNonNamespaced {
+		return nil, errors.New("--deletion-blockers can't be used with --include-non-namespaced, cluster-scoped resources don't block the deletion of namespaces")
+	}
+	if options.Orphans && (options.Export != "" || options.Stream || options.Watch) {
+		return nil, errors.New("--orphans can't be used with --export, --stream or --watch")
+	}
+	if options.Orphans && (commandLine.NArg() > 0 || len(options.Kinds) > 0 || len(options.ExcludedKinds) > 0 || len(options.Exclude) > 0 || len(ignoredKinds) > 0 || options.LabelSelector != "" || options.FieldSelector != "" || options.NamePattern != nil || options.OlderThan != 0 || options.NewerThan != 0) {
+		return nil, errors.New("--orphans needs every resource, it can't be used with a PATTERN, --kinds, --exclude, --ignore-kinds, --selector, --field-selector, --name, --older-than or --newer-than")
+	}
+	if options.OlderThan < 0 || options.NewerThan < 0 {
+		return nil, errors.New("--older-than and --newer-than must be positive")
+	}
+	if options.OlderThan != 0 && options.NewerThan != 0 && options.OlderThan >= options.NewerThan {
+		return nil, errors.New("--older-than must be shorter than --newer-than, no resource can match otherwise")
+	}
+	if options.Watch && (options.Export != "" || options.Stream) {
+		return nil, errors.New("--watch can't be used with --export or --stream")
+	}
+	if options.Watch && !contains(watchOutputFormats, options.Output) {
+		return nil, fmt.Errorf("--watch can only be used with the output formats: %s", strings.Join(watchOutputFormats, ", "))
+	}
+	if options.WatchInterval <= 0 {
+		return nil, errors.New("--watch-interval must be positive")
+	}
+	if options.AllNamespaces && (len(options.Namespaces) > 0 || options.NamespacePattern != nil) {
+		return nil, errors.New("--all-namespaces can't be used with --namespace or --namespace-pattern")
+	}
+	if options.multiCluster() && (options.Context != "" || options.Cluster != "") {
+		return nil, errors.New("--context and --cluster can't be used with --contexts or --context-pattern")
+	}
+	if options.Command == CommandDiff {
+		if options.Export != "" || options.Stream || options.Watch || options.Orphans || options.DeletionBlockers {
+			return nil, errors.New("diff can't be used with --export, --stream, --watch, --orphans or --deletion-blockers")
+		}
+		if commandLine.NArg() < 1 || commandLine.NArg() > 2 {
+			commandLine.Usage()
+			return nil, errors.New("diff takes the OLD inventory and an optional NEW inventory")
+		}
+		options.DiffFiles = commandLine.Args()
+		// the manifests of an OLD export are compared, the errors of the
+		// inventory are reported when it's loaded
+		if info, err := os.Stat(options.DiffFiles[0]); err == nil && info.IsDir() {
+			options.DiffManifests = true
+		}
+		return options, nil
+	}
+	if options.Command == CommandFind {
+		if options.Export != "" || options.Stream || options.Watch || options.Orphans || options.DeletionBlockers || options.NamePattern != nil {
+			return nil, errors.New("find can't be used with --export, --stream, --watch, --orphans, --deletion-blockers or --name")
+		}
+		if commandLine.NArg() != 1 {
+			commandLine.Usage()
+			return nil, errors.New("find takes the NAME to look for")
+		}
+		re, err := regexp.Compile(commandLine.Arg(0))
+		if err != nil {
+			return nil, fmt.Errorf("could not compile regex from name %q: %w", commandLine.Arg(0), err)
+		}
+		options.NamePattern = re
+		return options, nil
+	}
 	if commandLine.NArg() > 1 {
 		commandLine.Usage()
 		return nil, errors.New("too many args supplied")
@@ -51,3 +440,23 @@ func GetOptions(commandLineArgs []string) (*Options, error) {
 	}
 	return options, nil
 }
+
+// splitList splits a comma-separated list, ignoring empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,10 @@
 package cmd_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/duboisf/kubectl-fetch/internal/cmd"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
@@ -15,6 +18,314 @@ func TestGetOptions(t *testing.T) {
 		assert.Equals(t, 15, opts.MaxInFlight)
 	})
 
+	t.Run("all namespaces", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"-A"})
+		assert.Nil(t, err)
+		assert.True(t, opts.AllNamespaces)
+		opts, err = cmd.GetOptions([]string{"--all-namespaces"})
+		assert.Nil(t, err)
+		assert.True(t, opts.AllNamespaces)
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"-n", "a,b", "--namespace", "c", "--namespace-pattern", "^team-"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"a", "b", "c"}, opts.Namespaces)
+		assert.Equals(t, "^team-", opts.NamespacePattern.String())
+	})
+
+	t.Run("all namespaces can't be combined with specific namespaces", func(t *testing.T) {
+		_, err := cmd.GetOptions([]string{"-A", "-n", "a"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("kubectl global flags", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{
+			"--context", "prod",
+			"--kubeconfig", "/tmp/config",
+			"--cluster", "prod-cluster",
+			"--user", "admin",
+			"--as", "jane",
+			"--as-group", "devs",
+			"--as-group", "ops",
+			"--request-timeout", "5s",
+		})
+		assert.Nil(t, err)
+		expected := []string{
+			"--kubeconfig=/tmp/config",
+			"--context=prod",
+			"--cluster=prod-cluster",
+			"--user=admin",
+			"--as=jane",
+			"--as-group=devs",
+			"--as-group=ops",
+			"--request-timeout=5s",
+		}
+		assert.SliceEquals(t, expected, opts.KubectlFlags())
+	})
+
+	t.Run("no kubectl global flags by default", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.Equals(t, 0, len(opts.KubectlFlags()))
+	})
+
+	t.Run("contexts", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--contexts", "a,b", "--context-pattern", "^prod-"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"a", "b"}, opts.Contexts)
+		assert.Equals(t, "^prod-", opts.ContextPattern.String())
+	})
+
+	t.Run("a single context can't be combined with many contexts", func(t *testing.T) {
+		_, err := cmd.GetOptions([]string{"--context", "a", "--contexts", "b,c"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("keep going", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"-k"})
+		assert.Nil(t, err)
+		assert.True(t, opts.KeepGoing)
+	})
+
+	t.Run("selectors", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"-l", "app=payments", "--field-selector", "status.phase=Running"})
+		assert.Nil(t, err)
+		assert.Equals(t, "app=payments", opts.LabelSelector)
+		assert.Equals(t, "status.phase=Running", opts.FieldSelector)
+		opts, err = cmd.GetOptions([]string{"--selector", "tier=web"})
+		assert.Nil(t, err)
+		assert.Equals(t, "tier=web", opts.LabelSelector)
+	})
+
+	t.Run("kinds and exclude patterns", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--kinds", "Workloads,-replicasets", "--kinds", "configmaps", "--exclude", "^leases", "--exclude", "endpointslices"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"workloads", "configmaps"}, opts.Kinds)
+		assert.SliceEquals(t, []string{"replicasets"}, opts.ExcludedKinds)
+		assert.Equals(t, 2, len(opts.Exclude))
+	})
+
+	t.Run("ignored kinds", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.SliceEquals(t, cmd.DefaultIgnoredKinds, opts.IgnoredKinds)
+		opts, err = cmd.GetOptions([]string{"--ignore-kinds", "leases.coordination.k8s.io"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"events", "events.events.k8s.io", "leases.coordination.k8s.io"}, opts.IgnoredKinds)
+		opts, err = cmd.GetOptions([]string{"--include-events", "--ignore-kinds", "leases.coordination.k8s.io"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"leases.coordination.k8s.io"}, opts.IgnoredKinds)
+	})
+
+	t.Run("backend", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.BackendKubectl, opts.Backend)
+		opts, err = cmd.GetOptions([]string{"--backend", "rest"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.BackendREST, opts.Backend)
+		_, err = cmd.GetOptions([]string{"--backend", "grpc"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("discovery cache", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.Equals(t, 10*time.Minute, opts.DiscoveryTTL)
+		assert.True(t, !opts.RefreshDiscovery)
+		opts, err = cmd.GetOptions([]string{"--discovery-ttl", "6h", "--refresh-discovery"})
+		assert.Nil(t, err)
+		assert.Equals(t, 6*time.Hour, opts.DiscoveryTTL)
+		assert.True(t, opts.RefreshDiscovery)
+	})
+
+	t.Run("full objects", func(t *testing.T) {
+		dir := t.TempDir()
+		records := filepath.Join(dir, "old.json")
+		assert.Nil(t, os.WriteFile(records, []byte("[]"), 0o600))
+		for _, args := range [][]string{
+			{"--export", "/tmp/backup"},
+			{"diff", dir},
+			{"--orphans"},
+			{"--backend", "rest", "-o", "wide"},
+		} {
+			opts, err := cmd.GetOptions(args)
+			assert.Nil(t, err)
+			assert.True(t, opts.FullObjects())
+		}
+		for _, args := range [][]string{nil, {"-o", "json"}, {"-o", "wide"}, {"--backend", "rest"}, {"diff", records}} {
+			opts, err := cmd.GetOptions(args)
+			assert.Nil(t, err)
+			assert.True(t, !opts.FullObjects())
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--export", "/tmp/backup", "--strip-server-fields"})
+		assert.Nil(t, err)
+		assert.Equals(t, "/tmp/backup", opts.Export)
+		assert.True(t, opts.StripServerFields)
+		_, err = cmd.GetOptions([]string{"--strip-server-fields"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--export", "/tmp/backup", "--stream"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"diff", "-A", "old.json"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.CommandDiff, opts.Command)
+		assert.True(t, opts.AllNamespaces)
+		assert.SliceEquals(t, []string{"old.json"}, opts.DiffFiles)
+		opts, err = cmd.GetOptions([]string{"diff", "old.json", "new.json"})
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"old.json", "new.json"}, opts.DiffFiles)
+		_, err = cmd.GetOptions([]string{"diff"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"diff", "a", "b", "c"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"diff", "--export", "/tmp/backup", "old.json"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("find", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"find", "-A", "^payments-db$"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.CommandFind, opts.Command)
+		assert.True(t, opts.AllNamespaces)
+		assert.Equals(t, "^payments-db$", opts.NamePattern.String())
+		assert.True(t, opts.Pattern == nil)
+		_, err = cmd.GetOptions([]string{"find"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"find", "a", "b"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"find", "(a"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"find", "--watch", "a"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("name", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--name", "^payments-", "secrets"})
+		assert.Nil(t, err)
+		assert.Equals(t, "^payments-", opts.NamePattern.String())
+		assert.Equals(t, "secrets", opts.Pattern.String())
+		_, err = cmd.GetOptions([]string{"--orphans", "--name", "web"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("age", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--older-than", "1d12h", "--newer-than", "30d"})
+		assert.Nil(t, err)
+		assert.Equals(t, 36*time.Hour, opts.OlderThan)
+		assert.Equals(t, 30*24*time.Hour, opts.NewerThan)
+		_, err = cmd.GetOptions([]string{"--older-than", "30d", "--newer-than", "1d12h"})
+		assert.NotNil(t, err)
+		opts, err = cmd.GetOptions([]string{"--newer-than", "2h"})
+		assert.Nil(t, err)
+		assert.Equals(t, 2*time.Hour, opts.NewerThan)
+		opts, err = cmd.GetOptions([]string{"--older-than", "1.5d"})
+		assert.Nil(t, err)
+		assert.Equals(t, 36*time.Hour, opts.OlderThan)
+		_, err = cmd.GetOptions([]string{"--older-than", "-1d"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--orphans", "--older-than", "1d"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("orphans", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--orphans", "-A"})
+		assert.Nil(t, err)
+		assert.True(t, opts.Orphans)
+		_, err = cmd.GetOptions([]string{"--orphans", "configmaps"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--orphans", "--kinds", "configmaps"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--orphans", "-l", "app=web"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--orphans", "--ignore-kinds", "endpoints"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--orphans", "--watch"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("deletion blockers", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--deletion-blockers", "-n", "stuck"})
+		assert.Nil(t, err)
+		assert.True(t, opts.DeletionBlockers)
+		assert.True(t, opts.KeepGoing)
+		assert.True(t, opts.RefreshDiscovery)
+		_, err = cmd.GetOptions([]string{"--deletion-blockers", "-N"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--deletion-blockers", "--orphans"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.True(t, !opts.Watch)
+		assert.Equals(t, 10*time.Second, opts.WatchInterval)
+		opts, err = cmd.GetOptions([]string{"-w", "--watch-interval", "1m"})
+		assert.Nil(t, err)
+		assert.True(t, opts.Watch)
+		assert.Equals(t, time.Minute, opts.WatchInterval)
+		_, err = cmd.GetOptions([]string{"--watch", "--stream"})
+		assert.NotNil(t, err)
+		for _, output := range []string{"name", "wide", "ndjson"} {
+			_, err = cmd.GetOptions([]string{"--watch", "-o", output})
+			assert.Nil(t, err)
+		}
+		for _, output := range []string{"json", "yaml", "csv", "summary", "tree", "jsonpath={.items}"} {
+			_, err = cmd.GetOptions([]string{"--watch", "-o", output})
+			assert.NotNil(t, err)
+		}
+		_, err = cmd.GetOptions([]string{"--watch-interval", "0s"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("output format", func(t *testing.T) {
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.OutputName, opts.Output)
+		opts, err = cmd.GetOptions([]string{"-o", "ndjson"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.OutputNDJSON, opts.Output)
+		opts, err = cmd.GetOptions([]string{"-o", "markdown"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.OutputMarkdown, opts.Output)
+		_, err = cmd.GetOptions([]string{"-o", "xml"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("template output formats", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"-o", "jsonpath={.items[*].name}"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.OutputJSONPath, opts.Output)
+		assert.Equals(t, "{.items[*].name}", opts.Template)
+		opts, err = cmd.GetOptions([]string{"-o", "go-template={{range .items}}{{.name}} {{end}}"})
+		assert.Nil(t, err)
+		assert.Equals(t, cmd.OutputGoTemplate, opts.Output)
+		assert.Equals(t, "{{range .items}}{{.name}} {{end}}", opts.Template)
+		_, err = cmd.GetOptions([]string{"-o", "go-template"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"-o", "go-template={{.items"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"-o", "jsonpath={range .items[*]}"})
+		assert.NotNil(t, err)
+		_, err = cmd.GetOptions([]string{"--stream", "-o", "jsonpath={.items}"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--stream", "-o", "ndjson"})
+		assert.Nil(t, err)
+		assert.True(t, opts.Stream)
+		_, err = cmd.GetOptions([]string{"-s", "-o", "json"})
+		assert.NotNil(t, err)
+	})
+
 	t.Run("only takes 1 optional argument", func(t *testing.T) {
 		_, err := cmd.GetOptions([]string{"hi", "there"})
 		assert.NotNil(t, err)
@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// Reasons why a resource is likely orphaned
+const (
+	OrphanConfigMapNotReferenced = "ConfigMaps not referenced by any pod"
+	OrphanSecretNotReferenced    = "Secrets not referenced by any pod, service account or ingress"
+	OrphanServiceWithoutEndpoint = "Services without endpoints"
+	OrphanPVCNotMounted          = "PersistentVolumeClaims not mounted by any pod"
+	OrphanOwnersNotFound         = "Resources whose owners no longer exist"
+)
+
+// orphanReasons are the reasons in the order they are reported.
+var orphanReasons = []string{
+	OrphanConfigMapNotReferenced,
+	OrphanSecretNotReferenced,
+	OrphanServiceWithoutEndpoint,
+	OrphanPVCNotMounted,
+	OrphanOwnersNotFound,
+}
+
+// workloadKinds are the kinds whose pod spec, or pod template, references
+// configmaps, secrets and claims.
+var workloadKinds = []string{
+	"cronjobs.batch",
+	"daemonsets.apps",
+	"deployments.apps",
+	"jobs.batch",
+	"pods",
+	"replicasets.apps",
+	"replicationcontrollers",
+	"statefulsets.apps",
+}
+
+// orphanReferenceKinds are the kinds that reference the resources of each
+// reason. When the resources of one of them couldn't all be fetched, the
+// resources of the reason in the same namespace aren't reported since their
+// references are unknown.
+var orphanReferenceKinds = map[string][]string{
+	OrphanConfigMapNotReferenced: workloadKinds,
+	OrphanSecretNotReferenced:    append([]string{"ingresses.networking.k8s.io", "serviceaccounts"}, workloadKinds...),
+	OrphanServiceWithoutEndpoint: {"endpoints", "endpointslices.discovery.k8s.io"},
+	OrphanPVCNotMounted:          {"pods"},
+}
+
+// systemNamespaces contain resources managed by kubernetes itself, they are
+// never reported as orphaned.
+var systemNamespaces = []string{"kube-node-lease", "kube-public", "kube-system"}
+
+// managedSecretTypes are the types of the secrets that are used without
+// being referenced, e.g. by helm to store its releases.
+var managedSecretTypes = []string{
+	"bootstrap.kubernetes.io/token",
+	"helm.sh/release.v1",
+	"kubernetes.io/service-account-token",
+}
+
+// nameRef is a reference to a resource by name, e.g. in a configMapKeyRef.
+type nameRef struct {
+	Name string `json:"name"`
+}
+
+type container struct {
+	Env []struct {
+		ValueFrom *struct {
+			ConfigMapKeyRef *nameRef `json:"configMapKeyRef"`
+			SecretKeyRef    *nameRef `json:"secretKeyRef"`
+		} `json:"valueFrom"`
+	} `json:"env"`
+	EnvFrom []struct {
+		ConfigMapRef *nameRef `json:"configMapRef"`
+		SecretRef    *nameRef `json:"secretRef"`
+	} `json:"envFrom"`
+}
+
+// podSpec is the subset of the pod spec that references other resources.
+type podSpec struct {
+	Containers          []container `json:"containers"`
+	EphemeralContainers []container `json:"ephemeralContainers"`
+	ImagePullSecrets    []nameRef   `json:"imagePullSecrets"`
+	InitContainers      []container `json:"initContainers"`
+	Volumes             []struct {
+		ConfigMap             *nameRef `json:"configMap"`
+		PersistentVolumeClaim *struct {
+			ClaimName string `json:"claimName"`
+		} `json:"persistentVolumeClaim"`
+		Projected *struct {
+			Sources []struct {
+				ConfigMap *nameRef `json:"configMap"`
+				Secret    *nameRef `json:"secret"`
+			} `json:"sources"`
+		} `json:"projected"`
+		Secret *struct {
+			SecretName string `json:"secretName"`
+		} `json:"secret"`
+	} `json:"volumes"`
+}
+
+// orphanObject is the subset of the objects needed to find the orphaned
+// resources. The pod spec is either the spec of a pod or the template of a
+// workload, e.g. a deployment or a cronjob.
+type orphanObject struct {
+	Spec struct {
+		podSpec
+		Template *struct {
+			Spec podSpec `json:"spec"`
+		} `json:"template"`
+		JobTemplate *struct {
+			Spec struct {
+				Template struct {
+					Spec podSpec `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+		// TLS is the tls configuration of an ingress
+		TLS []struct {
+			SecretName string `json:"secretName"`
+		} `json:"tls"`
+		Type string `json:"type"`
+	} `json:"spec"`
+	// Endpoints are the endpoints of an endpoint slice
+	Endpoints []json.RawMessage `json:"endpoints"`
+	// ImagePullSecrets and Secrets are the secrets of a service account
+	ImagePullSecrets []nameRef `json:"imagePullSecrets"`
+	Secrets          []nameRef `json:"secrets"`
+	// Subsets are the subsets of an endpoints
+	Subsets []struct {
+		Addresses []json.RawMessage `json:"addresses"`
+	} `json:"subsets"`
+	// Type is the type of a secret
+	Type string `json:"type"`
+}
+
+// orphanFinder indexes the references between the resources, by cluster,
+// namespace and name of the referenced resources.
+type orphanFinder struct {
+	// failures are the kinds that couldn't be fetched
+	failures       []*FetchError
+	configMaps     map[string]bool
+	secrets        map[string]bool
+	mountedClaims  map[string]bool
+	servedServices map[string]bool
+	// kinds contains the group and kind of the resources of each cluster
+	kinds map[string]bool
+	uids  map[string]bool
+}
+
+func refKey(resource *kubectl.Resource, name string) string {
+	return resource.Cluster + "/" + resource.Namespace() + "/" + name
+}
+
+func newOrphanFinder(resources []*kubectl.Resource, objects map[*kubectl.Resource]*orphanObject, failures []*FetchError) *orphanFinder {
+	f := &orphanFinder{
+		failures:       failures,
+		configMaps:     make(map[string]bool),
+		secrets:        make(map[string]bool),
+		mountedClaims:  make(map[string]bool),
+		servedServices: make(map[string]bool),
+		kinds:          make(map[string]bool),
+		uids:           make(map[string]bool),
+	}
+	for _, resource := range resources {
+		f.kinds[resource.Cluster+"/"+resource.Group()+"/"+resource.Kind] = true
+		if resource.Metadata.UID != "" {
+			f.uids[resource.Cluster+"/"+resource.Metadata.UID] = true
+		}
+		object := objects[resource]
+		if object == nil {
+			continue
+		}
+		isPod := resource.Group() == "" && resource.Kind == "Pod"
+		f.addPodSpec(resource, &object.Spec.podSpec, isPod)
+		if object.Spec.Template != nil {
+			f.addPodSpec(resource, &object.Spec.Template.Spec, false)
+		}
+		if object.Spec.JobTemplate != nil {
+			f.addPodSpec(resource, &object.Spec.JobTemplate.Spec.Template.Spec, false)
+		}
+		switch resource.Group() + "/" + resource.Kind {
+		case "/ServiceAccount":
+			for _, ref := range append(object.Secrets, object.ImagePullSecrets...) {
+				f.secrets[refKey(resource, ref.Name)] = true
+			}
+		case "networking.k8s.io/Ingress":
+			for _, tls := range object.Spec.TLS {
+				f.secrets[refKey(resource, tls.SecretName)] = true
+			}
+		case "/Endpoints":
+			for _, subset := range object.Subsets {
+				if len(subset.Addresses) > 0 {
+					f.servedServices[refKey(resource, resource.Name())] = true
+				}
+			}
+		case "discovery.k8s.io/EndpointSlice":
+			if service := resource.Metadata.Labels["kubernetes.io/service-name"]; service != "" && len(object.Endpoints) > 0 {
+				f.servedServices[refKey(resource, service)] = true
+			}
+		}
+	}
+	return f
+}
+
+// addPodSpec indexes the resources referenced by the pod spec of the
+// resource. The claims are only mounted by actual pods.
+func (f *orphanFinder) addPodSpec(resource *kubectl.Resource, spec *podSpec, isPod bool) {
+	for _, ref := range spec.ImagePullSecrets {
+		f.secrets[refKey(resource, ref.Name)] = true
+	}
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			f.configMaps[refKey(resource, volume.ConfigMap.Name)] = true
+		}
+		if volume.Secret != nil {
+			f.secrets[refKey(resource, volume.Secret.SecretName)] = true
+		}
+		if volume.PersistentVolumeClaim != nil && isPod {
+			f.mountedClaims[refKey(resource, volume.PersistentVolumeClaim.ClaimName)] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					f.configMaps[refKey(resource, source.ConfigMap.Name)] = true
+				}
+				if source.Secret != nil {
+					f.secrets[refKey(resource, source.Secret.Name)] = true
+				}
+			}
+		}
+	}
+	for _, containers := range [][]container{spec.Containers, spec.InitContainers, spec.EphemeralContainers} {
+		for _, c := range containers {
+			for _, env := range c.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if env.ValueFrom.ConfigMapKeyRef != nil {
+					f.configMaps[refKey(resource, env.ValueFrom.ConfigMapKeyRef.Name)] = true
+				}
+				if env.ValueFrom.SecretKeyRef != nil {
+					f.secrets[refKey(resource, env.ValueFrom.SecretKeyRef.Name)] = true
+				}
+			}
+			for _, envFrom := range c.EnvFrom {
+				if envFrom.ConfigMapRef != nil {
+					f.configMaps[refKey(resource, envFrom.ConfigMapRef.Name)] = true
+				}
+				if envFrom.SecretRef != nil {
+					f.secrets[refKey(resource, envFrom.SecretRef.Name)] = true
+				}
+			}
+		}
+	}
+}
+
+// referencesUnknown returns true if the resources that could reference the
+// resource for the given reason couldn't all be fetched.
+func (f *orphanFinder) referencesUnknown(resource *kubectl.Resource, reason string) bool {
+	for _, kind := range orphanReferenceKinds[reason] {
+		referenceResource, group := splitKind(kind)
+		if kindFailed(f.failures, resource.Cluster, resource.Namespace(), group, "", referenceResource) {
+			return true
+		}
+	}
+	return false
+}
+
+// reason returns why the resource is likely orphaned, or an empty string.
+// The resources with owners are managed by their owners, they are only
+// reported when none of their owners exist anymore.
+func (f *orphanFinder) reason(resource *kubectl.Resource, object *orphanObject) string {
+	if owners := resource.Metadata.OwnerReferences; len(owners) > 0 {
+		if f.ownersNotFound(resource) {
+			return OrphanOwnersNotFound
+		}
+		return ""
+	}
+	if object == nil || contains(systemNamespaces, resource.Namespace()) {
+		return ""
+	}
+	key := refKey(resource, resource.Name())
+	switch resource.Group() + "/" + resource.Kind {
+	case "/ConfigMap":
+		// kube-root-ca.crt is published in every namespace
+		if !f.configMaps[key] && resource.Name() != "kube-root-ca.crt" {
+			return OrphanConfigMapNotReferenced
+		}
+	case "/Secret":
+		if !f.secrets[key] && !contains(managedSecretTypes, object.Type) {
+			return OrphanSecretNotReferenced
+		}
+	case "/Service":
+		if !f.servedServices[key] && object.Spec.Type != "ExternalName" {
+			return OrphanServiceWithoutEndpoint
+		}
+	case "/PersistentVolumeClaim":
+		if !f.mountedClaims[key] {
+			return OrphanPVCNotMounted
+		}
+	}
+	return ""
+}
+
+// ownersNotFound returns true when none of the owners of the resource were
+// found, while resources of the kinds of the owners were found and none of
+// these kinds failed to be fetched. The latter tells that the kinds of the
+// owners were fetched, e.g. a cluster-scoped owner isn't fetched without
+// --include-non-namespaced.
+func (f *orphanFinder) ownersNotFound(resource *kubectl.Resource) bool {
+	for _, owner := range resource.Metadata.OwnerReferences {
+		group, _, found := strings.Cut(owner.APIVersion, "/")
+		if !found {
+			group = ""
+		}
+		if f.uids[resource.Cluster+"/"+owner.UID] || !f.kinds[resource.Cluster+"/"+group+"/"+owner.Kind] {
+			return false
+		}
+		if kindFailed(f.failures, resource.Cluster, resource.Namespace(), group, owner.Kind, "") {
+			return false
+		}
+	}
+	return true
+}
+
+// findOrphans returns the resources that are likely orphaned, indexed by
+// reason, and the reasons for which some resources weren't reported because
+// the kinds that could reference them couldn't all be fetched.
+func findOrphans(resources []*kubectl.Resource, failures []*FetchError) (map[string][]*kubectl.Resource, map[string]bool) {
+	objects := make(map[*kubectl.Resource]*orphanObject, len(resources))
+	for _, resource := range resources {
+		if len(resource.Raw) == 0 {
+			continue
+		}
+		object := &orphanObject{}
+		// the objects whose schema doesn't match, e.g. a custom resource
+		// with another kind of template, don't reference anything
+		if err := json.Unmarshal(resource.Raw, object); err == nil {
+			objects[resource] = object
+		}
+	}
+	finder := newOrphanFinder(resources, objects, failures)
+	orphans := make(map[string][]*kubectl.Resource)
+	unknown := make(map[string]bool)
+	for _, resource := range resources {
+		reason := finder.reason(resource, objects[resource])
+		switch {
+		case reason == "":
+		case finder.referencesUnknown(resource, reason):
+			unknown[reason] = true
+		default:
+			orphans[reason] = append(orphans[reason], resource)
+		}
+	}
+	return orphans, unknown
+}
+
+// printOrphans writes the resources that are likely orphaned, grouped by
+// reason. With a partial fetch, the resources whose references couldn't all
+// be fetched aren't reported.
+func (c *Cmd) printOrphans(resources []*kubectl.Resource, partialErr *PartialFetchError) error {
+	var failures []*FetchError
+	if partialErr != nil {
+		failures = partialErr.Failures
+	}
+	orphans, unknown := findOrphans(resources, failures)
+	bufferedStdout := bufio.NewWriter(c.stdout)
+	var count int
+	for _, reason := range orphanReasons {
+		if len(orphans[reason]) == 0 {
+			continue
+		}
+		if count > 0 {
+			fmt.Fprintln(bufferedStdout)
+		}
+		fmt.Fprintln(bufferedStdout, reason+":")
+		for _, resource := range orphans[reason] {
+			fmt.Fprintln(bufferedStdout, "  "+c.formatName(resource))
+		}
+		count += len(orphans[reason])
+	}
+	if err := bufferedStdout.Flush(); err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Fprintln(c.stderr, "No orphaned resources found.")
+	} else {
+		fmt.Fprintf(c.stderr, "Found %d resources that are likely orphaned.\n", count)
+	}
+	var skipped []string
+	for _, reason := range orphanReasons {
+		if unknown[reason] {
+			skipped = append(skipped, reason)
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(c.stderr, "Some resources aren't reported since the resources that could reference them couldn't all be fetched: %s\n", strings.Join(skipped, ", "))
+	}
+	return nil
+}
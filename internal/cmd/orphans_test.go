@@ -0,0 +1,119 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestCmd_Run_Orphans(t *testing.T) {
+	t.Parallel()
+	runOrphans := func(t *testing.T, resources ...*kubectl.Resource) (string, string) {
+		t.Helper()
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources}, &cmd.Options{Orphans: true}, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+		assert.Nil(t, c.Run(context.Background()))
+		return stdout.builder.String(), stderr.String()
+	}
+
+	t.Run("reports the resources that are likely orphaned by reason", func(t *testing.T) {
+		resources := []*kubectl.Resource{
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "mounted", "namespace": "default"}}`),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "env", "namespace": "default"}}`),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "leftover", "namespace": "default"}}`),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "kube-root-ca.crt", "namespace": "default"}}`),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "coredns", "namespace": "kube-system"}}`),
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "managed", "namespace": "default", "ownerReferences": [{"apiVersion": "example.com/v1", "kind": "App", "name": "shop", "uid": "9"}]}}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "registry", "namespace": "default"}, "type": "kubernetes.io/dockerconfigjson"}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "tls", "namespace": "default"}, "type": "kubernetes.io/tls"}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "token", "namespace": "default"}, "type": "Opaque"}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "sh.helm.release.v1.shop.v1", "namespace": "default"}, "type": "helm.sh/release.v1"}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "old-password", "namespace": "default"}, "type": "Opaque"}`),
+			newRawResource(t, "v1", "ServiceAccount", `{"metadata": {"name": "builder", "namespace": "default"}, "imagePullSecrets": [{"name": "registry"}]}`),
+			newRawResource(t, "networking.k8s.io/v1", "Ingress", `{"metadata": {"name": "web", "namespace": "default"}, "spec": {"tls": [{"secretName": "tls"}]}}`),
+			newRawResource(t, "v1", "Service", `{"metadata": {"name": "web", "namespace": "default"}, "spec": {"selector": {"app": "web"}}}`),
+			newRawResource(t, "v1", "Service", `{"metadata": {"name": "api", "namespace": "default"}, "spec": {"selector": {"app": "api"}}}`),
+			newRawResource(t, "v1", "Service", `{"metadata": {"name": "legacy", "namespace": "default"}, "spec": {"selector": {"app": "legacy"}}}`),
+			newRawResource(t, "v1", "Service", `{"metadata": {"name": "db", "namespace": "default"}, "spec": {"type": "ExternalName", "externalName": "db.example.com"}}`),
+			newRawResource(t, "v1", "Endpoints", `{"metadata": {"name": "web", "namespace": "default"}, "subsets": [{"addresses": [{"ip": "10.0.0.1"}]}]}`),
+			newRawResource(t, "v1", "Endpoints", `{"metadata": {"name": "legacy", "namespace": "default"}, "subsets": []}`),
+			newRawResource(t, "discovery.k8s.io/v1", "EndpointSlice", `{"metadata": {"name": "api-x2x4z", "namespace": "default", "labels": {"kubernetes.io/service-name": "api"}}, "endpoints": [{"addresses": ["10.0.0.2"]}]}`),
+			newRawResource(t, "v1", "PersistentVolumeClaim", `{"metadata": {"name": "data", "namespace": "default"}}`),
+			newRawResource(t, "v1", "PersistentVolumeClaim", `{"metadata": {"name": "scaled-down", "namespace": "default"}}`),
+			newRawResource(t, "apps/v1", "ReplicaSet", `{"metadata": {"name": "web-5d8f7c", "namespace": "default", "uid": "1"}}`),
+			newRawResource(t, "v1", "Pod", `{"metadata": {"name": "web-5d8f7c-a", "namespace": "default", "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web-5d8f7c", "uid": "1"}]},
+				"spec": {"volumes": [{"name": "config", "configMap": {"name": "mounted"}}, {"name": "data", "persistentVolumeClaim": {"claimName": "data"}}],
+					"containers": [{"name": "web", "env": [{"name": "TOKEN", "valueFrom": {"secretKeyRef": {"name": "token", "key": "token"}}}]}]}}`),
+			newRawResource(t, "v1", "Pod", `{"metadata": {"name": "web-6b9d4f-a", "namespace": "default", "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web-6b9d4f", "uid": "2"}]}}`),
+			newRawResource(t, "v1", "Pod", `{"metadata": {"name": "mirror", "namespace": "default", "ownerReferences": [{"apiVersion": "v1", "kind": "Node", "name": "node-1", "uid": "3"}]}}`),
+			newRawResource(t, "apps/v1", "Deployment", `{"metadata": {"name": "worker", "namespace": "default"}, "spec": {"replicas": 0, "template": {"spec": {
+				"containers": [{"name": "worker", "envFrom": [{"configMapRef": {"name": "env"}}]}],
+				"volumes": [{"name": "data", "persistentVolumeClaim": {"claimName": "scaled-down"}}]}}}}`),
+		}
+
+		stdout, stderr := runOrphans(t, resources...)
+
+		expected := `ConfigMaps not referenced by any pod:
+  configmap/leftover
+
+Secrets not referenced by any pod, service account or ingress:
+  secret/old-password
+
+Services without endpoints:
+  service/legacy
+
+PersistentVolumeClaims not mounted by any pod:
+  persistentvolumeclaim/scaled-down
+
+Resources whose owners no longer exist:
+  pod/web-6b9d4f-a
+`
+		assert.Equals(t, expected, stdout)
+		assert.Equals(t, "Found 5 resources that are likely orphaned.\n", stderr)
+	})
+
+	t.Run("references only count within the namespace", func(t *testing.T) {
+		stdout, _ := runOrphans(t,
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "a"}}`),
+			newRawResource(t, "v1", "Pod", `{"metadata": {"name": "web", "namespace": "b"}, "spec": {"volumes": [{"name": "config", "configMap": {"name": "settings"}}]}}`),
+		)
+
+		assert.Equals(t, "ConfigMaps not referenced by any pod:\n  configmap/settings\n", stdout)
+	})
+
+	t.Run("doesn't report the resources whose referencing kinds couldn't be fetched", func(t *testing.T) {
+		resources := []*kubectl.Resource{
+			newRawResource(t, "v1", "ConfigMap", `{"metadata": {"name": "settings", "namespace": "default"}}`),
+			newRawResource(t, "v1", "Secret", `{"metadata": {"name": "password", "namespace": "default"}, "type": "Opaque"}`),
+			newRawResource(t, "v1", "PersistentVolumeClaim", `{"metadata": {"name": "data", "namespace": "default"}}`),
+			newRawResource(t, "v1", "Service", `{"metadata": {"name": "legacy", "namespace": "default"}, "spec": {"selector": {"app": "legacy"}}}`),
+			newRawResource(t, "v1", "Endpoints", `{"metadata": {"name": "legacy", "namespace": "default"}, "subsets": []}`),
+		}
+		partialErr := &cmd.PartialFetchError{Failures: []*cmd.FetchError{{Namespace: "default", Kind: "pods", Err: errors.New("forbidden")}}}
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		c, err := cmd.NewCmd(&mockFetcher{resources: resources, err: partialErr}, &cmd.Options{Orphans: true}, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.True(t, err == partialErr)
+		assert.Equals(t, "Services without endpoints:\n  service/legacy\n", stdout.builder.String())
+		assert.Contains(t, stderr.String(), "Some resources aren't reported since the resources that could reference them couldn't all be fetched: "+
+			cmd.OrphanConfigMapNotReferenced+", "+cmd.OrphanSecretNotReferenced+", "+cmd.OrphanPVCNotMounted+"\n")
+	})
+
+	t.Run("reports when nothing is orphaned", func(t *testing.T) {
+		stdout, stderr := runOrphans(t, newRawResource(t, "v1", "Pod", `{"metadata": {"name": "web", "namespace": "default"}}`))
+
+		assert.Equals(t, "", stdout)
+		assert.Equals(t, "No orphaned resources found.\n", stderr)
+	})
+}
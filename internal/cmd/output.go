@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+// Record is the structured representation of a resource in the json, yaml
+// and ndjson outputs.
+type Record struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func newRecord(resource *kubectl.Resource) *Record {
+	return &Record{
+		Cluster:   resource.Cluster,
+		Group:     resource.Group(),
+		Version:   resource.Version(),
+		Kind:      resource.Kind,
+		Resource:  resource.Resource,
+		Namespace: resource.Namespace(),
+		Name:      resource.Name(),
+	}
+}
+
+func newRecords(resources []*kubectl.Resource) []*Record {
+	records := make([]*Record, 0, len(resources))
+	for _, resource := range resources {
+		records = append(records, newRecord(resource))
+	}
+	return records
+}
+
+// printJSON writes the resources as an indented JSON array of records.
+func printJSON(w io.Writer, resources []*kubectl.Resource) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newRecords(resources))
+}
+
+// printNDJSON writes one JSON record per line.
+func printNDJSON(w io.Writer, resources []*kubectl.Resource) error {
+	encoder := json.NewEncoder(w)
+	for _, resource := range resources {
+		if err := encoder.Encode(newRecord(resource)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printYAML writes the resources as a YAML sequence of records.
+func printYAML(w io.Writer, resources []*kubectl.Resource) error {
+	output, err := yaml.Marshal(newRecords(resources))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(output)
+	return err
+}
+
+// printWide writes the resources as tables of name, age, status, owner and
+// number of labels, with one table per kind.
+func printWide(w io.Writer, resources []*kubectl.Resource, options *Options, now time.Time) error {
+	showNamespace := options.showNamespaces()
+	for i, group := range groupByKind(resources) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		table := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		var header []string
+		if options.multiCluster() {
+			header = append(header, "CONTEXT")
+		}
+		if showNamespace {
+			header = append(header, "NAMESPACE")
+		}
+		header = append(header, "NAME", "AGE", "STATUS", "OWNER", "LABELS")
+		fmt.Fprintln(table, strings.Join(header, "\t"))
+		for _, resource := range group {
+			var row []string
+			if options.multiCluster() {
+				row = append(row, resource.Cluster)
+			}
+			if showNamespace {
+				row = append(row, resource.Namespace())
+			}
+			row = append(row,
+				resource.String(),
+				formatAge(now.Sub(resource.Metadata.CreationTimestamp)),
+				valueOrNone(resource.Status()),
+				valueOrNone(formatOwner(resource)),
+				strconv.Itoa(len(resource.Metadata.Labels)),
+			)
+			fmt.Fprintln(table, strings.Join(row, "\t"))
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupByKind splits the resources by kind, sorted by kind. The order of the
+// resources is kept within a kind.
+func groupByKind(resources []*kubectl.Resource) [][]*kubectl.Resource {
+	groups := make(map[string][]*kubectl.Resource)
+	var kinds []string
+	for _, resource := range resources {
+		kind := kindOf(resource)
+		if _, found := groups[kind]; !found {
+			kinds = append(kinds, kind)
+		}
+		groups[kind] = append(groups[kind], resource)
+	}
+	sort.Strings(kinds)
+	grouped := make([][]*kubectl.Resource, 0, len(kinds))
+	for _, kind := range kinds {
+		grouped = append(grouped, groups[kind])
+	}
+	return grouped
+}
+
+// kindOf returns the kind of the resource in the `kubectl get -o name`
+// format, e.g. deployment.apps
+func kindOf(resource *kubectl.Resource) string {
+	kind, _, _ := strings.Cut(resource.String(), "/")
+	return kind
+}
+
+// formatOwner returns the controller of the resource, or its first owner,
+// e.g. ReplicaSet/foo-5d8f7c. When there are many owners, the number of
+// other owners is appended, e.g. ReplicaSet/foo-5d8f7c+1.
+func formatOwner(resource *kubectl.Resource) string {
+	owners := resource.Metadata.OwnerReferences
+	if len(owners) == 0 {
+		return ""
+	}
+	owner := owners[0]
+	for _, ref := range owners {
+		if ref.Controller != nil && *ref.Controller {
+			owner = ref
+			break
+		}
+	}
+	formatted := owner.Kind + "/" + owner.Name
+	if len(owners) > 1 {
+		formatted += "+" + strconv.Itoa(len(owners)-1)
+	}
+	return formatted
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// formatAge returns a short human readable duration, the same way kubectl
+// formats the age of resources, e.g. 45s, 3m20s, 5h, 12d.
+func formatAge(d time.Duration) string {
+	seconds := int(d.Seconds())
+	switch {
+	case seconds < 0:
+		return "0s"
+	case seconds < 60*2:
+		return fmt.Sprintf("%ds", seconds)
+	}
+	minutes := int(d.Minutes())
+	switch {
+	case minutes < 10:
+		if s := seconds % 60; s != 0 {
+			return fmt.Sprintf("%dm%ds", minutes, s)
+		}
+		return fmt.Sprintf("%dm", minutes)
+	case minutes < 60*3:
+		return fmt.Sprintf("%dm", minutes)
+	}
+	hours := int(d.Hours())
+	switch {
+	case hours < 8:
+		if m := minutes % 60; m != 0 {
+			return fmt.Sprintf("%dh%dm", hours, m)
+		}
+		return fmt.Sprintf("%dh", hours)
+	case hours < 48:
+		return fmt.Sprintf("%dh", hours)
+	case hours < 24*8:
+		if h := hours % 24; h != 0 {
+			return fmt.Sprintf("%dd%dh", hours/24, h)
+		}
+		return fmt.Sprintf("%dd", hours/24)
+	case hours < 24*365*2:
+		return fmt.Sprintf("%dd", hours/24)
+	case hours < 24*365*8:
+		if days := (hours / 24) % 365; days != 0 {
+			return fmt.Sprintf("%dy%dd", hours/24/365, days)
+		}
+		return fmt.Sprintf("%dy", hours/24/365)
+	}
+	return fmt.Sprintf("%dy", hours/24/365)
+}
+
+// printSummary writes a table of the number of resources of each kind, per
+// namespace when fetching from more than one namespace, sorted by context,
+// namespace and kind.
+func printSummary(w io.Writer, resources []*kubectl.Resource, options *Options) error {
+	showNamespace := options.showNamespaces()
+	type row struct {
+		cluster, namespace, kind string
+	}
+	counts := make(map[row]int)
+	var rows []row
+	for _, resource := range resources {
+		r := row{cluster: resource.Cluster, kind: kindOf(resource)}
+		if showNamespace {
+			r.namespace = resource.Namespace()
+		}
+		if _, found := counts[r]; !found {
+			rows = append(rows, r)
+		}
+		counts[r]++
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.cluster != b.cluster {
+			return a.cluster < b.cluster
+		}
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.kind < b.kind
+	})
+	table := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	var header []string
+	if options.multiCluster() {
+		header = append(header, "CONTEXT")
+	}
+	if showNamespace {
+		header = append(header, "NAMESPACE")
+	}
+	header = append(header, "KIND", "COUNT")
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	for _, r := range rows {
+		var columns []string
+		if options.multiCluster() {
+			columns = append(columns, r.cluster)
+		}
+		if showNamespace {
+			columns = append(columns, r.namespace)
+		}
+		columns = append(columns, r.kind, strconv.Itoa(counts[r]))
+		fmt.Fprintln(table, strings.Join(columns, "\t"))
+	}
+	return table.Flush()
+}
+
+// tableColumns are the columns of the csv and markdown outputs. They don't
+// depend on the options so that the tables can be compared and imported the
+// same way every time.
+var tableColumns = []string{"cluster", "namespace", "group", "kind", "name", "age"}
+
+// tableRows returns the records of the resources with their age, in the
+// order of tableColumns.
+func tableRows(resources []*kubectl.Resource, now time.Time) [][]string {
+	rows := make([][]string, 0, len(resources))
+	for _, resource := range resources {
+		record := newRecord(resource)
+		rows = append(rows, []string{
+			record.Cluster,
+			record.Namespace,
+			record.Group,
+			record.Kind,
+			record.Name,
+			formatAge(now.Sub(resource.Metadata.CreationTimestamp)),
+		})
+	}
+	return rows
+}
+
+// printCSV writes the resources as CSV, with a header.
+func printCSV(w io.Writer, resources []*kubectl.Resource, now time.Time) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(tableColumns); err != nil {
+		return err
+	}
+	return writer.WriteAll(tableRows(resources, now))
+}
+
+// printMarkdown writes the resources as a Markdown table.
+func printMarkdown(w io.Writer, resources []*kubectl.Resource, now time.Time) error {
+	separator := make([]string, len(tableColumns))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	lines := []string{markdownRow(tableColumns), markdownRow(separator)}
+	for _, row := range tableRows(resources, now) {
+		lines = append(lines, markdownRow(row))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// markdownRow returns the cells as a row of a Markdown table, escaping the
+// pipes that would end a cell.
+func markdownRow(cells []string) string {
+	escaped := make([]string, 0, len(cells))
+	for _, cell := range cells {
+		escaped = append(escaped, strings.ReplaceAll(cell, "|", `\|`))
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
@@ -0,0 +1,185 @@
+package cmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+var now = time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func runWithOutput(t *testing.T, options *cmd.Options, resources ...*kubectl.Resource) string {
+	t.Helper()
+	stdout := &mockStdout{}
+	c, err := cmd.NewCmd(&mockFetcher{resources: resources}, options, stdout, &strings.Builder{}, &mockStarter{})
+	assert.Nil(t, err)
+	c.Now = func() time.Time { return now }
+	err = c.Run(context.Background())
+	assert.Nil(t, err)
+	return stdout.builder.String()
+}
+
+func TestCmd_Run_WideOutput(t *testing.T) {
+	t.Parallel()
+	t.Run("renders a table per kind", func(t *testing.T) {
+		controller := true
+		pod := newResource("v1", "Pod", "default", "web-5d8f7c-x2x4z")
+		pod.Metadata.CreationTimestamp = now.Add(-90 * time.Second)
+		pod.Metadata.Labels = map[string]string{"app": "web", "pod-template-hash": "5d8f7c"}
+		pod.Metadata.OwnerReferences = []kubectl.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d8f7c", Controller: &controller}}
+		pod.RawStatus = json.RawMessage(`{"phase": "Running"}`)
+		deleted := newResource("v1", "Pod", "default", "old")
+		deleted.Metadata.CreationTimestamp = now.Add(-50 * time.Hour)
+		deleted.Metadata.DeletionTimestamp = &now
+		deployment := newResource("apps/v1", "Deployment", "default", "web")
+		deployment.Metadata.CreationTimestamp = now.Add(-400 * 24 * time.Hour)
+		deployment.Metadata.Labels = map[string]string{"app": "web"}
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputWide}, pod, deleted, deployment)
+
+		expected := `NAME                  AGE    STATUS   OWNER    LABELS
+deployment.apps/web   400d   <none>   <none>   1
+
+NAME                   AGE    STATUS        OWNER                   LABELS
+pod/web-5d8f7c-x2x4z   90s    Running       ReplicaSet/web-5d8f7c   2
+pod/old                2d2h   Terminating   <none>                  0
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("shows the context and namespace when relevant", func(t *testing.T) {
+		configMap := newResource("v1", "ConfigMap", "kube-system", "coredns")
+		configMap.Cluster = "prod"
+		configMap.Metadata.CreationTimestamp = now.Add(-5 * time.Minute)
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputWide, AllNamespaces: true, Contexts: []string{"prod"}}, configMap)
+
+		expected := `CONTEXT   NAMESPACE     NAME                AGE   STATUS   OWNER    LABELS
+prod      kube-system   configmap/coredns   5m    <none>   <none>   0
+`
+		assert.Equals(t, expected, actual)
+	})
+}
+
+func TestCmd_Run_SummaryOutput(t *testing.T) {
+	t.Parallel()
+	resources := func() []*kubectl.Resource {
+		return []*kubectl.Resource{
+			newResource("v1", "Pod", "default", "web-0"),
+			newResource("apps/v1", "Deployment", "default", "web"),
+			newResource("v1", "Pod", "default", "web-1"),
+			newResource("v1", "Pod", "kube-system", "coredns"),
+		}
+	}
+
+	t.Run("counts the resources of each kind", func(t *testing.T) {
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputSummary}, resources()...)
+
+		expected := `KIND              COUNT
+deployment.apps   1
+pod               3
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("counts the resources of each kind per namespace", func(t *testing.T) {
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputSummary, AllNamespaces: true}, resources()...)
+
+		expected := `NAMESPACE     KIND              COUNT
+default       deployment.apps   1
+default       pod               2
+kube-system   pod               1
+`
+		assert.Equals(t, expected, actual)
+	})
+}
+
+func TestCmd_Run_TemplateOutput(t *testing.T) {
+	t.Parallel()
+	resources := func() []*kubectl.Resource {
+		return []*kubectl.Resource{
+			newResource("v1", "Pod", "default", "web-0"),
+			newResource("apps/v1", "Deployment", "kube-system", "coredns"),
+		}
+	}
+
+	t.Run("go-template", func(t *testing.T) {
+		options := &cmd.Options{
+			Output:   cmd.OutputGoTemplate,
+			Template: `{{range .items}}{{.kind}} {{.namespace}}/{{.name}}{{"\n"}}{{end}}`,
+		}
+		actual := runWithOutput(t, options, resources()...)
+
+		expected := "Pod default/web-0\nDeployment kube-system/coredns\n"
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("jsonpath", func(t *testing.T) {
+		options := &cmd.Options{
+			Output:   cmd.OutputJSONPath,
+			Template: `{range .items[?(@.group=="")]}{.namespace}/{.name}{"\n"}{end}{.items[*].kind}`,
+		}
+		actual := runWithOutput(t, options, resources()...)
+
+		expected := "default/web-0\nPod Deployment"
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("applies the templates to an empty list when there are no resources", func(t *testing.T) {
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputGoTemplate, Template: `{{len .items}}`})
+		assert.Equals(t, "0", actual)
+		actual = runWithOutput(t, &cmd.Options{Output: cmd.OutputJSONPath, Template: `found: {.items[*].name}`})
+		assert.Equals(t, "found: ", actual)
+	})
+}
+
+func TestCmd_Run_TableExportOutput(t *testing.T) {
+	t.Parallel()
+	resources := func() []*kubectl.Resource {
+		pod := newResource("v1", "Pod", "default", "web-0")
+		pod.Cluster = "prod"
+		pod.Metadata.CreationTimestamp = now.Add(-90 * time.Second)
+		namespace := newResource("v1", "Namespace", "", "team|a")
+		namespace.Cluster = "prod"
+		namespace.Metadata.CreationTimestamp = now.Add(-50 * time.Hour)
+		deployment := newResource("apps/v1", "Deployment", "default", "web")
+		deployment.Cluster = "prod"
+		deployment.Metadata.CreationTimestamp = now.Add(-400 * 24 * time.Hour)
+		return []*kubectl.Resource{pod, namespace, deployment}
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputCSV}, resources()...)
+
+		expected := `cluster,namespace,group,kind,name,age
+prod,default,,Pod,web-0,90s
+prod,,,Namespace,team|a,2d2h
+prod,default,apps,Deployment,web,400d
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputMarkdown}, resources()...)
+
+		expected := `| cluster | namespace | group | kind | name | age |
+| --- | --- | --- | --- | --- | --- |
+| prod | default |  | Pod | web-0 | 90s |
+| prod |  |  | Namespace | team\|a | 2d2h |
+| prod | default | apps | Deployment | web | 400d |
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("writes the header when there are no resources", func(t *testing.T) {
+		assert.Equals(t, "cluster,namespace,group,kind,name,age\n", runWithOutput(t, &cmd.Options{Output: cmd.OutputCSV}))
+		expected := "| cluster | namespace | group | kind | name | age |\n| --- | --- | --- | --- | --- | --- |\n"
+		assert.Equals(t, expected, runWithOutput(t, &cmd.Options{Output: cmd.OutputMarkdown}))
+	})
+}
@@ -3,39 +3,65 @@ package cmd
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
 )
 
 // ProgressDisplayer is an interface for terminal.UI
 type ProgressDisplayer interface {
 	SetTotalKinds(int) chan<- *terminal.GetResourcesUpdate
+	SetTotalKindsPerCluster(map[string]int)
 }
 
 // KubeClient is an interface for kubectl.Kubectl
 type KubeClient interface {
 	ListApiResources(ctx context.Context, namespaced bool) ([]string, error)
-	GetResources(ctx context.Context, kind string) ([]string, error)
+	GetResources(ctx context.Context, kind string) ([]*kubectl.Resource, error)
+	GetAllNamespacesResources(ctx context.Context, kind string) ([]*kubectl.Resource, error)
+	GetNamespacedResources(ctx context.Context, namespace, kind string) ([]*kubectl.Resource, error)
+	ListContexts(ctx context.Context) ([]string, error)
+	ListNamespaces(ctx context.Context) ([]string, error)
 }
 
+// KubeClientFactory returns a KubeClient that talks to the cluster of the
+// given kubeconfig context.
+type KubeClientFactory func(kubeContext string) KubeClient
+
 type Plugin struct {
 	kubeClient KubeClient
 	options    *Options
 	ui         ProgressDisplayer
-}
-
-type fetchResult struct {
-	results []string
-	err     error
+	// NewKubeClient is used to get a KubeClient for each context when
+	// fetching from many contexts.
+	NewKubeClient KubeClientFactory
+	// Now returns the current time, it's used to filter the resources by age
+	Now func() time.Time
+	// watchTasks are the tasks of the last fetch, they are listed again
+	// periodically by Watch
+	watchTasks []*fetchTask
+	// snapshots are the resources last listed by each watched task
+	snapshots map[*fetchTask][]*kubectl.Resource
+	// fetchedAt is when the last fetch started, the resources listed by
+	// Watch are filtered by their age at that time so that they aren't
+	// reported as created or deleted when they age past --older-than or
+	// --newer-than
+	fetchedAt time.Time
+	// skippedKinds is the number of kinds that the last fetch didn't fetch
+	// since matches were found in their cluster with find
+	skippedKinds int
 }
 
 type getResourcesResult struct {
-	kind      string
-	resources []string
+	task      *fetchTask
+	resources []*kubectl.Resource
 	err       error
 }
 
@@ -45,44 +71,146 @@ func NewPlugin(kubeClient KubeClient, options *Options, tui ProgressDisplayer) (
 		kubeClient: kubeClient,
 		options:    options,
 		ui:         tui,
+		NewKubeClient: func(string) KubeClient {
+			return kubeClient
+		},
+		Now: time.Now,
 	}, nil
 }
 
-func (p *Plugin) Fetch(ctx context.Context) ([]string, error) {
+// cluster is a kubernetes cluster to fetch resources from. Its name is the
+// kubeconfig context, it's empty when using the current context.
+type cluster struct {
+	name       string
+	kubeClient KubeClient
+	// kinds are the kinds discovered in the cluster, before filtering them
+	kinds []string
+}
+
+// fetchTask is a single call to the KubeClient to get the resources of a
+// kind, optionally in a specific namespace.
+type fetchTask struct {
+	cluster      string
+	kind         string
+	namespace    string
+	getResources func(ctx context.Context, kind string) ([]*kubectl.Resource, error)
+}
+
+// Fetch returns the resources of every kind found in the selected clusters and
+// namespaces. With --keep-going, the failures to get the resources of some
+// kinds are returned in a *PartialFetchError along with the resources that
+// could be fetched.
+func (p *Plugin) Fetch(ctx context.Context) ([]*kubectl.Resource, error) {
+	batches := make(chan []*kubectl.Resource)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- p.Stream(ctx, batches)
+	}()
+	var allResources []*kubectl.Resource
+	for batch := range batches {
+		allResources = append(allResources, batch...)
+	}
+	err := <-streamErr
+	var partialErr *PartialFetchError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, err
+	}
+	kubectl.SortResources(allResources)
+	return allResources, err
+}
+
+// Stream sends the resources of each kind on the `batches` channel as soon as
+// they are fetched, sorted within the kind. The channel is closed when all the
+// kinds have been fetched or on error. With --keep-going, the failures to get
+// the resources of some kinds are returned in a *PartialFetchError. With
+// find, no kind of a cluster is fetched once matches are found in it.
+func (p *Plugin) Stream(ctx context.Context, batches chan<- []*kubectl.Resource) error {
+	defer close(batches)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	wg := sync.WaitGroup{}
-	kinds, err := p.kubeClient.ListApiResources(ctx, true)
+	clusters, err := p.selectClusters(ctx)
+	if err != nil {
+		return err
+	}
+	p.fetchedAt = p.Now()
+	p.skippedKinds = 0
+	maxParallel := make(chan struct{}, p.options.MaxInFlight)
+	tasks, failures, err := p.discover(ctx, clusters, maxParallel)
 	if err != nil {
-		return nil, fmt.Errorf("could not get namespaced API resources:\n%w", err)
+		return err
+	}
+	if p.options.Watch {
+		p.watchTasks = tasks
+		p.snapshots = make(map[*fetchTask][]*kubectl.Resource, len(tasks))
 	}
-	if p.options.Pattern != nil {
-		kinds = filterKinds(kinds, p.options.Pattern)
+	totalKinds := len(tasks)
+	if p.options.multiCluster() {
+		p.ui.SetTotalKindsPerCluster(countTasksPerCluster(tasks))
 	}
-	totalKinds := len(kinds)
 	getResourcesUpdates := p.ui.SetTotalKinds(totalKinds)
 
-	maxParallel := make(chan struct{}, p.options.MaxInFlight)
 	getResourcesResults := make(chan *getResourcesResult, totalKinds)
+	// with find, no kind of a cluster is fetched once matches are found in
+	// it, the kinds of the cluster being fetched are still searched
+	var foundMu sync.Mutex
+	foundClusters := make(map[string]bool)
+	clusterFound := func(cluster string) bool {
+		foundMu.Lock()
+		defer foundMu.Unlock()
+		return foundClusters[cluster]
+	}
+	// skipped is only read once the results are closed, after the tasks
+	// were started
+	var skipped int
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for _, kind := range kinds {
-			maxParallel <- struct{}{}
-			kind := kind
+		for _, task := range tasks {
+			if clusterFound(task.cluster) {
+				skipped++
+				continue
+			}
+			select {
+			case maxParallel <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			if clusterFound(task.cluster) {
+				// the matches were found while waiting for a slot
+				<-maxParallel
+				skipped++
+				continue
+			}
+			task := task
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				resources, err := p.kubeClient.GetResources(ctx, kind)
+				resources, err := task.getResources(ctx, task.kind)
+				var notSupportedErr *kubectl.FieldSelectorNotSupportedError
+				if errors.As(err, &notSupportedErr) {
+					// no resource of this kind can match the field selector
+					err = nil
+				}
+				resources = p.options.filterResources(resources, p.fetchedAt)
+				for _, resource := range resources {
+					resource.Cluster = task.cluster
+				}
 				getResourcesResults <- &getResourcesResult{
-					kind:      kind,
+					task:      task,
 					resources: resources,
 					err:       err,
 				}
-				getResourcesUpdates <- &terminal.GetResourcesUpdate{
-					Kind:      kind,
+				update := &terminal.GetResourcesUpdate{
+					Cluster:   task.cluster,
+					Kind:      task.kind,
+					Namespace: task.namespace,
 					Resources: len(resources),
 				}
+				if p.options.showNamespaces() {
+					update.Namespaces = namespacesOf(resources)
+				}
+				getResourcesUpdates <- update
 			}()
 		}
 	}()
@@ -92,33 +220,290 @@ func (p *Plugin) Fetch(ctx context.Context) ([]string, error) {
 		wg.Wait()
 	}()
 
-	var allResources []string
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		case results, more := <-getResourcesResults:
 			if !more {
-				sort.Strings(allResources)
+				p.skippedKinds = skipped
 				close(getResourcesUpdates)
-				return allResources, nil
+				if len(failures) > 0 {
+					return &PartialFetchError{Failures: failures}
+				}
+				return nil
 			}
-			if results.err != nil {
-				cancel()
-				return nil, results.err
+			if p.options.Command == CommandFind && len(results.resources) > 0 {
+				// before freeing a slot, so that no other kind of the
+				// cluster is fetched
+				foundMu.Lock()
+				foundClusters[results.task.cluster] = true
+				foundMu.Unlock()
 			}
-			allResources = append(allResources, results.resources...)
 			<-maxParallel
+			if results.err != nil {
+				if !p.options.KeepGoing {
+					cancel()
+					return results.err
+				}
+				failures = append(failures, &FetchError{
+					Cluster:   results.task.cluster,
+					Namespace: results.task.namespace,
+					Kind:      results.task.kind,
+					Err:       results.err,
+				})
+				continue
+			}
+			if p.options.Watch {
+				p.snapshots[results.task] = results.resources
+			}
+			if len(results.resources) == 0 {
+				continue
+			}
+			select {
+			case batches <- results.resources:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 }
 
-func filterKinds(kinds []string, pattern *regexp.Regexp) []string {
-	var filtered []string
+// SkippedKinds returns the number of kinds that the last fetch didn't fetch
+// since matches were found in their cluster with find.
+func (p *Plugin) SkippedKinds() int {
+	return p.skippedKinds
+}
+
+// selectClusters returns the clusters to fetch resources from, which is the
+// current context unless many contexts were requested.
+func (p *Plugin) selectClusters(ctx context.Context) ([]*cluster, error) {
+	if !p.options.multiCluster() {
+		return []*cluster{{kubeClient: p.kubeClient}}, nil
+	}
+	contexts := p.options.Contexts
+	if p.options.ContextPattern != nil {
+		kubeContexts, err := p.kubeClient.ListContexts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list kubeconfig contexts:\n%w", err)
+		}
+		contexts = append(contexts, filterMatching(kubeContexts, p.options.ContextPattern)...)
+	}
+	contexts = uniqueSorted(contexts)
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no contexts match the pattern %q", p.options.ContextPattern)
+	}
+	clusters := make([]*cluster, 0, len(contexts))
+	for _, kubeContext := range contexts {
+		clusters = append(clusters, &cluster{
+			name:       kubeContext,
+			kubeClient: p.NewKubeClient(kubeContext),
+		})
+	}
+	return clusters, nil
+}
+
+// discover lists the fetch tasks of every cluster concurrently, using the
+// maxParallel semaphore to limit the number of concurrent calls. The tasks of
+// the clusters are interleaved so that the clusters share the parallel calls
+// budget fairly. With --keep-going, the discovery failures that don't prevent
+// fetching resources are returned instead of an error.
+func (p *Plugin) discover(ctx context.Context, clusters []*cluster, maxParallel chan struct{}) ([]*fetchTask, []*FetchError, error) {
+	tasksPerCluster := make([][]*fetchTask, len(clusters))
+	failuresPerCluster := make([][]*FetchError, len(clusters))
+	errs := make([]error, len(clusters))
+	wg := sync.WaitGroup{}
+	for i, c := range clusters {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			maxParallel <- struct{}{}
+			defer func() { <-maxParallel }()
+			tasksPerCluster[i], failuresPerCluster[i], errs[i] = p.listFetchTasks(ctx, c)
+		}()
+	}
+	wg.Wait()
+	var failures []*FetchError
+	for i, c := range clusters {
+		if errs[i] == nil {
+			failures = append(failures, failuresPerCluster[i]...)
+			continue
+		}
+		if c.name == "" {
+			return nil, nil, errs[i]
+		}
+		if !p.options.KeepGoing {
+			return nil, nil, fmt.Errorf("context %s: %w", c.name, errs[i])
+		}
+		// an unreachable cluster doesn't prevent fetching from the others
+		failures = append(failures, &FetchError{Cluster: c.name, Err: errs[i]})
+	}
+	if len(failures) == 0 {
+		// the kinds of the API groups that couldn't be discovered are unknown
+		var discovered []string
+		for i, c := range clusters {
+			if errs[i] == nil {
+				discovered = append(discovered, c.kinds...)
+			}
+		}
+		if unknown := p.options.unknownKindNames(discovered); len(unknown) > 0 {
+			return nil, nil, fmt.Errorf("no kind matches %s, see kubectl api-resources for the plural names of the kinds, the cluster-scoped kinds also need --include-non-namespaced", strings.Join(unknown, ", "))
+		}
+	}
+	totalTasks := countTasks(tasksPerCluster)
+	tasks := make([]*fetchTask, 0, totalTasks)
+	for i := 0; len(tasks) < totalTasks; i++ {
+		for _, clusterTasks := range tasksPerCluster {
+			if i < len(clusterTasks) {
+				tasks = append(tasks, clusterTasks[i])
+			}
+		}
+	}
+	return tasks, failures, nil
+}
+
+// listFetchTasks discovers the kinds to fetch in the given cluster and returns
+// a fetchTask for each one of them.
+func (p *Plugin) listFetchTasks(ctx context.Context, c *cluster) ([]*fetchTask, []*FetchError, error) {
+	var failures []*FetchError
+	kinds, err := c.kubeClient.ListApiResources(ctx, true)
+	if err != nil {
+		if !p.canKeepGoing(err) {
+			return nil, nil, fmt.Errorf("could not get namespaced API resources:\n%w", err)
+		}
+		failures = append(failures, &FetchError{Cluster: c.name, Err: err})
+	}
+	c.kinds = append(c.kinds, kinds...)
+	kinds = p.options.filterKinds(kinds)
+	var tasks []*fetchTask
+	switch {
+	case p.options.AllNamespaces:
+		tasks = newFetchTasks(c.name, kinds, "", c.kubeClient.GetAllNamespacesResources)
+	case len(p.options.Namespaces) > 0 || p.options.NamespacePattern != nil:
+		namespaces, err := p.selectNamespaces(ctx, c.kubeClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, namespace := range namespaces {
+			namespace := namespace
+			getResources := func(ctx context.Context, kind string) ([]*kubectl.Resource, error) {
+				return c.kubeClient.GetNamespacedResources(ctx, namespace, kind)
+			}
+			tasks = append(tasks, newFetchTasks(c.name, kinds, namespace, getResources)...)
+		}
+	default:
+		tasks = newFetchTasks(c.name, kinds, "", c.kubeClient.GetResources)
+	}
+	if p.options.IncludeNonNamespaced {
+		kinds, err := c.kubeClient.ListApiResources(ctx, false)
+		if err != nil {
+			if !p.canKeepGoing(err) {
+				return nil, nil, fmt.Errorf("could not get non-namespaced API resources:\n%w", err)
+			}
+			// the unavailable API groups are the same as for the namespaced
+			// API resources, only report them once
+			if len(failures) == 0 {
+				failures = append(failures, &FetchError{Cluster: c.name, Err: err})
+			}
+		}
+		c.kinds = append(c.kinds, kinds...)
+		kinds = p.options.filterKinds(kinds)
+		tasks = append(tasks, newFetchTasks(c.name, kinds, "", c.kubeClient.GetResources)...)
+	}
+	return tasks, failures, nil
+}
+
+// canKeepGoing returns true if the given discovery error is a partial
+// discovery failure and we're running with --keep-going.
+func (p *Plugin) canKeepGoing(err error) bool {
+	var partialErr *kubectl.PartialDiscoveryError
+	return p.options.KeepGoing && errors.As(err, &partialErr)
+}
+
+// selectNamespaces returns the namespaces explicitly given on the command
+// line along with the namespaces of the cluster that match the namespace
+// pattern, if any.
+func (p *Plugin) selectNamespaces(ctx context.Context, kubeClient KubeClient) ([]string, error) {
+	namespaces := append([]string{}, p.options.Namespaces...)
+	if p.options.NamespacePattern != nil {
+		clusterNamespaces, err := kubeClient.ListNamespaces(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list namespaces:\n%w", err)
+		}
+		namespaces = append(namespaces, filterMatching(clusterNamespaces, p.options.NamespacePattern)...)
+	}
+	namespaces = uniqueSorted(namespaces)
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("no namespaces match the pattern %q", p.options.NamespacePattern)
+	}
+	return namespaces, nil
+}
+
+func newFetchTasks(cluster string, kinds []string, namespace string, getResources func(context.Context, string) ([]*kubectl.Resource, error)) []*fetchTask {
+	tasks := make([]*fetchTask, 0, len(kinds))
 	for _, kind := range kinds {
-		if pattern.MatchString(kind) {
-			filtered = append(filtered, kind)
+		tasks = append(tasks, &fetchTask{
+			cluster:      cluster,
+			kind:         kind,
+			namespace:    namespace,
+			getResources: getResources,
+		})
+	}
+	return tasks
+}
+
+func countTasks(tasksPerCluster [][]*fetchTask) int {
+	var count int
+	for _, tasks := range tasksPerCluster {
+		count += len(tasks)
+	}
+	return count
+}
+
+func countTasksPerCluster(tasks []*fetchTask) map[string]int {
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		counts[task.cluster]++
+	}
+	return counts
+}
+
+// filterMatching returns the values that match the given pattern.
+func filterMatching(values []string, pattern *regexp.Regexp) []string {
+	var filtered []string
+	for _, value := range values {
+		if pattern.MatchString(value) {
+			filtered = append(filtered, value)
 		}
 	}
 	return filtered
 }
+
+// uniqueSorted returns the sorted distinct values of the given slice.
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// namespacesOf returns the distinct namespaces of the given resources.
+func namespacesOf(resources []*kubectl.Resource) []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		namespace := resource.Namespace()
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
@@ -2,17 +2,25 @@ package cmd_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
 )
 
 type mockUI struct {
-	actualTotalKinds int
-	updates          chan *terminal.GetResourcesUpdate
+	actualTotalKinds           int
+	actualTotalKindsPerCluster map[string]int
+	updates                    chan *terminal.GetResourcesUpdate
 }
 
 func (m *mockUI) SetTotalKinds(i int) chan<- *terminal.GetResourcesUpdate {
@@ -20,25 +28,82 @@ func (m *mockUI) SetTotalKinds(i int) chan<- *terminal.GetResourcesUpdate {
 	return m.updates
 }
 
+func (m *mockUI) SetTotalKindsPerCluster(kindsPerCluster map[string]int) {
+	m.actualTotalKindsPerCluster = kindsPerCluster
+}
+
 type mockKubeClient struct {
 	listApiResources struct {
+		output              []string
+		nonNamespacedOutput []string
+		err                 error
+	}
+	getResources struct {
+		// mu guards output, which is replaced while watching
+		mu     sync.Mutex
+		output map[string][]*kubectl.Resource
+		err    error
+		// errs is indexed by kind, for kinds that must fail
+		errs map[string]error
+	}
+	getAllNamespacesResources struct {
+		calls int32
+	}
+	getNamespacedResources struct {
+		// output is indexed by "<namespace>/<kind>"
+		output map[string][]*kubectl.Resource
+	}
+	listContexts struct {
 		output []string
 		err    error
 	}
-	getResources struct {
-		output map[string][]string
+	listNamespaces struct {
+		output []string
 		err    error
 	}
 }
 
 func (m *mockKubeClient) ListApiResources(ctx context.Context, namespaced bool) ([]string, error) {
+	if !namespaced {
+		return m.listApiResources.nonNamespacedOutput, m.listApiResources.err
+	}
 	return m.listApiResources.output, m.listApiResources.err
 }
 
-func (m *mockKubeClient) GetResources(ctx context.Context, kind string) ([]string, error) {
+func (m *mockKubeClient) GetResources(ctx context.Context, kind string) ([]*kubectl.Resource, error) {
+	if err, found := m.getResources.errs[kind]; found {
+		return nil, err
+	}
+	m.getResources.mu.Lock()
+	defer m.getResources.mu.Unlock()
+	return m.getResources.output[kind], m.getResources.err
+}
+
+func (m *mockKubeClient) GetAllNamespacesResources(ctx context.Context, kind string) ([]*kubectl.Resource, error) {
+	atomic.AddInt32(&m.getAllNamespacesResources.calls, 1)
 	return m.getResources.output[kind], m.getResources.err
 }
 
+func (m *mockKubeClient) GetNamespacedResources(ctx context.Context, namespace, kind string) ([]*kubectl.Resource, error) {
+	return m.getNamespacedResources.output[namespace+"/"+kind], m.getResources.err
+}
+
+func (m *mockKubeClient) ListContexts(ctx context.Context) ([]string, error) {
+	return m.listContexts.output, m.listContexts.err
+}
+
+func (m *mockKubeClient) ListNamespaces(ctx context.Context) ([]string, error) {
+	return m.listNamespaces.output, m.listNamespaces.err
+}
+
+func resourceNames(resources []*kubectl.Resource) []string {
+	var names []string
+	for _, resource := range resources {
+		names = append(names, resource.String())
+	}
+	return names
+}
+
 func TestPlugin_Fetch(t *testing.T) {
 	t.Parallel()
 
@@ -51,9 +116,12 @@ func TestPlugin_Fetch(t *testing.T) {
 			"deployment",
 			"configmap",
 		}
-		kubeClient.getResources.output = map[string][]string{
-			"deployment": {"deployment/foo"},
-			"service":    {"service/bar", "service/baz"},
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"deployment": {newResource("apps/v1", "Deployment", "default", "foo")},
+			"service": {
+				newResource("v1", "Service", "default", "bar"),
+				newResource("v1", "Service", "default", "baz"),
+			},
 		}
 		opts, err := cmd.GetOptions([]string{"(deployment|service)"})
 		assert.Nil(t, err)
@@ -67,8 +135,589 @@ func TestPlugin_Fetch(t *testing.T) {
 
 		// Then
 		assert.Nil(t, err)
-		expectedResources := []string{"deployment/foo", "service/bar", "service/baz"}
-		assert.SliceEquals(t, expectedResources, resources)
+		expectedResources := []string{"deployment.apps/foo", "service/bar", "service/baz"}
+		assert.SliceEquals(t, expectedResources, resourceNames(resources))
+	})
+
+	t.Run("returns resources across all namespaces sorted by namespace", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "service"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {
+				newResource("v1", "ConfigMap", "kube-system", "coredns"),
+				newResource("v1", "ConfigMap", "default", "foo"),
+			},
+			"service": {newResource("v1", "Service", "default", "kubernetes")},
+		}
+		opts, err := cmd.GetOptions([]string{"-A"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, len(kubeClient.listApiResources.output))
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		assert.Equals(t, 2, atomic.LoadInt32(&kubeClient.getAllNamespacesResources.calls))
+		expectedResources := []string{"configmap/foo", "service/kubernetes", "configmap/coredns"}
+		assert.SliceEquals(t, expectedResources, resourceNames(resources))
+		var namespaces []string
+		for i := 0; i < 2; i++ {
+			namespaces = append(namespaces, (<-ui.updates).Namespaces...)
+		}
+		assert.Equals(t, 3, len(namespaces))
+	})
+
+	t.Run("also returns cluster-scoped resources when including non-namespaced kinds", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap"}
+		kubeClient.listApiResources.nonNamespacedOutput = []string{"clusterrole.rbac.authorization.k8s.io", "namespace"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {newResource("v1", "ConfigMap", "default", "foo")},
+			"clusterrole.rbac.authorization.k8s.io": {
+				newResource("rbac.authorization.k8s.io/v1", "ClusterRole", "", "admin"),
+			},
+		}
+		opts, err := cmd.GetOptions([]string{"--include-non-namespaced", "(configmap|clusterrole)"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		assert.Equals(t, 2, ui.actualTotalKinds)
+		expectedResources := []string{"clusterrole.rbac.authorization.k8s.io/admin", "configmap/foo"}
+		assert.SliceEquals(t, expectedResources, resourceNames(resources))
+	})
+
+	t.Run("returns resources of the selected namespaces grouped by namespace", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "service"}
+		kubeClient.listNamespaces.output = []string{"default", "team-a", "team-b", "team-c"}
+		kubeClient.getNamespacedResources.output = map[string][]*kubectl.Resource{
+			"team-b/service":   {newResource("v1", "Service", "team-b", "api")},
+			"team-b/configmap": {newResource("v1", "ConfigMap", "team-b", "config")},
+			"team-a/service":   {newResource("v1", "Service", "team-a", "web")},
+			"default/service":  {newResource("v1", "Service", "default", "kubernetes")},
+		}
+		opts, err := cmd.GetOptions([]string{"-n", "default", "--namespace-pattern", "^team-[ab]$"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 6)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		assert.Equals(t, 6, ui.actualTotalKinds)
+		var actual []string
+		for _, resource := range resources {
+			actual = append(actual, resource.Namespace()+"/"+resource.String())
+		}
+		expected := []string{"default/service/kubernetes", "team-a/service/web", "team-b/configmap/config", "team-b/service/api"}
+		assert.SliceEquals(t, expected, actual)
+	})
+
+	t.Run("returns an error if no namespaces match the namespace pattern", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap"}
+		kubeClient.listNamespaces.output = []string{"default"}
+		opts, err := cmd.GetOptions([]string{"--namespace-pattern", "^team-"})
+		assert.Nil(t, err)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, &mockUI{})
+		assert.Nil(t, err)
+
+		// When
+		_, err = plugin.Fetch(context.Background())
+
+		// Then
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "no namespaces match")
+	})
+
+	t.Run("returns resources from many contexts prefixed by their cluster", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listContexts.output = []string{"dev", "prod-eu", "prod-us"}
+		clusterClients := map[string]*mockKubeClient{}
+		for _, name := range []string{"prod-eu", "prod-us"} {
+			client := &mockKubeClient{}
+			client.listApiResources.output = []string{"configmap", "service"}
+			client.getResources.output = map[string][]*kubectl.Resource{
+				"service": {newResource("v1", "Service", "default", name+"-svc")},
+			}
+			clusterClients[name] = client
+		}
+		opts, err := cmd.GetOptions([]string{"--context-pattern", "^prod-"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 4)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		plugin.NewKubeClient = func(kubeContext string) cmd.KubeClient {
+			return clusterClients[kubeContext]
+		}
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		assert.Equals(t, 4, ui.actualTotalKinds)
+		assert.Equals(t, 2, ui.actualTotalKindsPerCluster["prod-eu"])
+		assert.Equals(t, 2, ui.actualTotalKindsPerCluster["prod-us"])
+		var actual []string
+		for _, resource := range resources {
+			actual = append(actual, resource.Cluster+":"+resource.String())
+		}
+		assert.SliceEquals(t, []string{"prod-eu:service/prod-eu-svc", "prod-us:service/prod-us-svc"}, actual)
+	})
+
+	t.Run("returns an error naming the context whose discovery failed", func(t *testing.T) {
+		// Given
+		broken := &mockKubeClient{}
+		broken.listApiResources.err = fmt.Errorf("connection refused")
+		opts, err := cmd.GetOptions([]string{"--contexts", "a,b"})
+		assert.Nil(t, err)
+		plugin, err := cmd.NewPlugin(&mockKubeClient{}, opts, &mockUI{})
+		assert.Nil(t, err)
+		plugin.NewKubeClient = func(kubeContext string) cmd.KubeClient {
+			if kubeContext == "b" {
+				return broken
+			}
+			return &mockKubeClient{}
+		}
+
+		// When
+		_, err = plugin.Fetch(context.Background())
+
+		// Then
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "context b: ")
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+
+	t.Run("keeps going when getting the resources of a kind fails", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "podmetrics.metrics.k8s.io", "service"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {newResource("v1", "ConfigMap", "default", "foo")},
+			"service":   {newResource("v1", "Service", "default", "bar")},
+		}
+		kubeClient.getResources.errs = map[string]error{
+			"podmetrics.metrics.k8s.io": fmt.Errorf("the server is currently unable to handle the request"),
+		}
+		opts, err := cmd.GetOptions([]string{"--keep-going"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		var partialErr *cmd.PartialFetchError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equals(t, 1, len(partialErr.Failures))
+		assert.Equals(t, "podmetrics.metrics.k8s.io", partialErr.Failures[0].Kind)
+		assert.SliceEquals(t, []string{"configmap/foo", "service/bar"}, resourceNames(resources))
+	})
+
+	t.Run("skips the kinds that don't support the field selector", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "pod"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"pod": {newResource("v1", "Pod", "default", "foo")},
+		}
+		kubeClient.getResources.errs = map[string]error{
+			"configmap": &kubectl.FieldSelectorNotSupportedError{Kind: "configmap", FieldSelector: "status.phase=Running"},
+		}
+		opts, err := cmd.GetOptions([]string{"--field-selector", "status.phase=Running"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 2)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"pod/foo"}, resourceNames(resources))
+	})
+
+	t.Run("keeps going when some API groups can't be discovered", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap"}
+		kubeClient.listApiResources.err = &kubectl.PartialDiscoveryError{Message: "metrics.k8s.io/v1beta1: unavailable"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {newResource("v1", "ConfigMap", "default", "foo")},
+		}
+		opts, err := cmd.GetOptions([]string{"--keep-going", "--include-non-namespaced"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 1)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		var partialErr *cmd.PartialFetchError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equals(t, 1, len(partialErr.Failures))
+		assert.Contains(t, partialErr.Failures[0].Error(), "metrics.k8s.io/v1beta1")
+		assert.SliceEquals(t, []string{"configmap/foo"}, resourceNames(resources))
+	})
+
+	t.Run("returns an error when some API groups can't be discovered without keep going", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap"}
+		kubeClient.listApiResources.err = &kubectl.PartialDiscoveryError{Message: "metrics.k8s.io/v1beta1: unavailable"}
+		opts, err := cmd.GetOptions(nil)
+		assert.Nil(t, err)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, &mockUI{})
+		assert.Nil(t, err)
+
+		// When
+		_, err = plugin.Fetch(context.Background())
+
+		// Then
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "metrics.k8s.io/v1beta1")
+	})
+
+	t.Run("keeps going when a context is unreachable", func(t *testing.T) {
+		// Given
+		broken := &mockKubeClient{}
+		broken.listApiResources.err = fmt.Errorf("connection refused")
+		healthy := &mockKubeClient{}
+		healthy.listApiResources.output = []string{"configmap"}
+		healthy.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {newResource("v1", "ConfigMap", "default", "foo")},
+		}
+		opts, err := cmd.GetOptions([]string{"-k", "--contexts", "a,b"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 1)
+		plugin, err := cmd.NewPlugin(&mockKubeClient{}, opts, ui)
+		assert.Nil(t, err)
+		plugin.NewKubeClient = func(kubeContext string) cmd.KubeClient {
+			if kubeContext == "b" {
+				return broken
+			}
+			return healthy
+		}
+
+		// When
+		resources, err := plugin.Fetch(context.Background())
+
+		// Then
+		var partialErr *cmd.PartialFetchError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equals(t, "b", partialErr.Failures[0].Cluster)
+		assert.SliceEquals(t, []string{"configmap/foo"}, resourceNames(resources))
+	})
+
+	t.Run("streams the resources of each kind sorted within the kind", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "secret", "service"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {newResource("v1", "ConfigMap", "default", "a"), newResource("v1", "ConfigMap", "default", "b")},
+			"service":   {newResource("v1", "Service", "default", "c")},
+		}
+		opts, err := cmd.GetOptions([]string{"--stream"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		batches := make(chan []*kubectl.Resource)
+		streamErr := make(chan error, 1)
+
+		// When
+		go func() {
+			streamErr <- plugin.Stream(context.Background(), batches)
+		}()
+
+		// Then
+		var actual [][]string
+		for batch := range batches {
+			actual = append(actual, resourceNames(batch))
+		}
+		assert.Nil(t, <-streamErr)
+		// kinds without resources aren't sent
+		assert.Equals(t, 2, len(actual))
+		for _, batch := range actual {
+			if batch[0] == "configmap/a" {
+				assert.SliceEquals(t, []string{"configmap/a", "configmap/b"}, batch)
+			} else {
+				assert.SliceEquals(t, []string{"service/c"}, batch)
+			}
+		}
+	})
+
+	t.Run("only gets the selected kinds", func(t *testing.T) {
+		discovered := []string{
+			"configmaps",
+			"cronjobs.batch",
+			"deployments.apps",
+			"endpointslices.discovery.k8s.io",
+			"leases.coordination.k8s.io",
+			"pods",
+			"replicasets.apps",
+			"rolebindings.rbac.authorization.k8s.io",
+			"serviceaccounts",
+			"services",
+			"virtualservices.networking.istio.io",
+		}
+		tests := []struct {
+			name     string
+			args     []string
+			expected []string
+		}{
+			{
+				name:     "exclude patterns",
+				args:     []string{"--exclude", "^leases", "--exclude", "endpointslices|replicasets"},
+				expected: []string{"configmaps", "cronjobs.batch", "deployments.apps", "pods", "rolebindings.rbac.authorization.k8s.io", "serviceaccounts", "services", "virtualservices.networking.istio.io"},
+			},
+			{
+				name:     "kinds with or without their group",
+				args:     []string{"--kinds", "pods,deployments,leases.coordination.k8s.io"},
+				expected: []string{"deployments.apps", "leases.coordination.k8s.io", "pods"},
+			},
+			{
+				name:     "named groups",
+				args:     []string{"--kinds", "workloads,rbac"},
+				expected: []string{"cronjobs.batch", "deployments.apps", "pods", "replicasets.apps", "rolebindings.rbac.authorization.k8s.io", "serviceaccounts"},
+			},
+			{
+				name:     "networking",
+				args:     []string{"--kinds", "networking"},
+				expected: []string{"endpointslices.discovery.k8s.io", "services"},
+			},
+			{
+				name:     "crds",
+				args:     []string{"--kinds", "crds"},
+				expected: []string{"virtualservices.networking.istio.io"},
+			},
+			{
+				name:     "skipped kinds",
+				args:     []string{"--kinds", "workloads,-replicasets", "--kinds=-pods"},
+				expected: []string{"cronjobs.batch", "deployments.apps"},
+			},
+			{
+				name:     "only skipped kinds",
+				args:     []string{"--kinds=-workloads,-networking,-rbac,-crds,-leases"},
+				expected: []string{"configmaps"},
+			},
+			{
+				name:     "ignored kinds",
+				args:     []string{"--ignore-kinds", "leases.coordination.k8s.io,endpointslices.discovery.k8s.io", "--kinds", "networking,leases"},
+				expected: []string{"services"},
+			},
+			{
+				name:     "combined with the pattern",
+				args:     []string{"--kinds", "workloads", "apps"},
+				expected: []string{"deployments.apps", "replicasets.apps"},
+			},
+		}
+		for _, test := range tests {
+			test := test
+			t.Run(test.name, func(t *testing.T) {
+				// Given
+				kubeClient := &mockKubeClient{}
+				kubeClient.listApiResources.output = discovered
+				opts, err := cmd.GetOptions(test.args)
+				assert.Nil(t, err)
+				ui := &mockUI{}
+				ui.updates = make(chan *terminal.GetResourcesUpdate, len(discovered))
+				plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+				assert.Nil(t, err)
+
+				// When
+				_, err = plugin.Fetch(context.Background())
+
+				// Then
+				assert.Nil(t, err)
+				var fetchedKinds []string
+				for update := range ui.updates {
+					fetchedKinds = append(fetchedKinds, update.Kind)
+				}
+				sort.Strings(fetchedKinds)
+				assert.SliceEquals(t, test.expected, fetchedKinds)
+			})
+		}
+	})
+
+	t.Run("bare kind names only select the builtin kind", func(t *testing.T) {
+		// Given
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"nodes.metrics.k8s.io", "pods", "pods.metrics.k8s.io", "widgets.example.com"}
+		opts, err := cmd.GetOptions([]string{"--kinds", "pods,widgets"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 4)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+
+		// When
+		_, err = plugin.Fetch(context.Background())
+
+		// Then
+		assert.Nil(t, err)
+		var fetchedKinds []string
+		for update := range ui.updates {
+			fetchedKinds = append(fetchedKinds, update.Kind)
+		}
+		sort.Strings(fetchedKinds)
+		assert.SliceEquals(t, []string{"pods", "widgets.example.com"}, fetchedKinds)
+	})
+
+	t.Run("returns an error for the kinds that match no discovered kind", func(t *testing.T) {
+		tests := [][]string{
+			{"--kinds", "pod"},
+			{"--kinds", "pod,-deployments"},
+		}
+		for _, args := range tests {
+			// Given
+			kubeClient := &mockKubeClient{}
+			kubeClient.listApiResources.output = []string{"deployments.apps", "pods"}
+			opts, err := cmd.GetOptions(args)
+			assert.Nil(t, err)
+			ui := &mockUI{}
+			ui.updates = make(chan *terminal.GetResourcesUpdate, 2)
+			plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+			assert.Nil(t, err)
+
+			// When
+			_, err = plugin.Fetch(context.Background())
+
+			// Then
+			assert.NotNil(t, err)
+			assert.True(t, strings.Contains(err.Error(), "no kind matches "))
+		}
+	})
+
+	t.Run("ignores the exclusions that match no discovered kind", func(t *testing.T) {
+		tests := [][]string{
+			{"--kinds", "workloads,-leases"},
+			{"--exclude", "istio"},
+		}
+		for _, args := range tests {
+			// Given
+			kubeClient := &mockKubeClient{}
+			kubeClient.listApiResources.output = []string{"deployments.apps", "pods"}
+			kubeClient.getResources.output = map[string][]*kubectl.Resource{
+				"pods": {newResource("v1", "Pod", "default", "web")},
+			}
+			opts, err := cmd.GetOptions(args)
+			assert.Nil(t, err)
+			ui := &mockUI{}
+			ui.updates = make(chan *terminal.GetResourcesUpdate, 2)
+			plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+			assert.Nil(t, err)
+
+			// When
+			resources, err := plugin.Fetch(context.Background())
+
+			// Then
+			assert.Nil(t, err)
+			assert.SliceEquals(t, []string{"pod/web"}, resourceNames(resources))
+		}
+	})
+
+	t.Run("ignores events unless including them", func(t *testing.T) {
+		for _, includeEvents := range []bool{false, true} {
+			// Given
+			kubeClient := &mockKubeClient{}
+			kubeClient.listApiResources.output = []string{"events", "events.events.k8s.io", "pods"}
+			kubeClient.getResources.output = map[string][]*kubectl.Resource{
+				"events":               {newResource("v1", "Event", "default", "foo.1")},
+				"events.events.k8s.io": {newResource("events.k8s.io/v1", "Event", "default", "foo.1")},
+				"pods":                 {newResource("v1", "Pod", "default", "events")},
+			}
+			var args []string
+			expected := []string{"pod/events"}
+			if includeEvents {
+				args = []string{"--include-events"}
+				expected = []string{"event.events.k8s.io/foo.1", "event/foo.1", "pod/events"}
+			}
+			opts, err := cmd.GetOptions(args)
+			assert.Nil(t, err)
+			ui := &mockUI{}
+			ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+			plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+			assert.Nil(t, err)
+
+			// When
+			resources, err := plugin.Fetch(context.Background())
+
+			// Then
+			assert.Nil(t, err)
+			assert.SliceEquals(t, expected, resourceNames(resources))
+		}
+	})
+
+	t.Run("gets the events when they are named explicitly", func(t *testing.T) {
+		tests := []struct {
+			args     []string
+			expected []string
+		}{
+			{[]string{"--kinds", "events"}, []string{"event/foo.1"}},
+			{[]string{"--kinds", "events.events.k8s.io,pods"}, []string{"event.events.k8s.io/foo.1", "pod/events"}},
+			{[]string{"events"}, []string{"event.events.k8s.io/foo.1", "event/foo.1"}},
+			{[]string{"^events$"}, []string{"event/foo.1"}},
+			{[]string{"--kinds", "workloads,networking"}, []string{"pod/events"}},
+			{[]string{"."}, []string{"pod/events"}},
+		}
+		for _, test := range tests {
+			// Given
+			kubeClient := &mockKubeClient{}
+			kubeClient.listApiResources.output = []string{"events", "events.events.k8s.io", "pods"}
+			kubeClient.getResources.output = map[string][]*kubectl.Resource{
+				"events":               {newResource("v1", "Event", "default", "foo.1")},
+				"events.events.k8s.io": {newResource("events.k8s.io/v1", "Event", "default", "foo.1")},
+				"pods":                 {newResource("v1", "Pod", "default", "events")},
+			}
+			opts, err := cmd.GetOptions(test.args)
+			assert.Nil(t, err)
+			ui := &mockUI{}
+			ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+			plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+			assert.Nil(t, err)
+
+			// When
+			resources, err := plugin.Fetch(context.Background())
+
+			// Then
+			assert.Nil(t, err)
+			assert.SliceEquals(t, test.expected, resourceNames(resources))
+		}
 	})
 
 	t.Run("returns an error if there's an error getting the list of api resources", func(t *testing.T) {
@@ -114,3 +763,133 @@ func TestPlugin_Fetch(t *testing.T) {
 		assert.Contains(t, err.Error(), "error getting resources")
 	})
 }
+
+func TestPlugin_Fetch_Name(t *testing.T) {
+	t.Parallel()
+	newKubeClient := func() *mockKubeClient {
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap", "secret", "service"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {
+				newResource("v1", "ConfigMap", "default", "payments-db"),
+				newResource("v1", "ConfigMap", "default", "web"),
+			},
+			"secret":  {newResource("v1", "Secret", "default", "payments-db")},
+			"service": {newResource("v1", "Service", "default", "api")},
+		}
+		return kubeClient
+	}
+	fetch := func(t *testing.T, args ...string) ([]*kubectl.Resource, int) {
+		t.Helper()
+		opts, err := cmd.GetOptions(args)
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 3)
+		plugin, err := cmd.NewPlugin(newKubeClient(), opts, ui)
+		assert.Nil(t, err)
+		resources, err := plugin.Fetch(context.Background())
+		assert.Nil(t, err)
+		return resources, plugin.SkippedKinds()
+	}
+
+	t.Run("only returns the resources whose name matches", func(t *testing.T) {
+		resources, _ := fetch(t, "--name", "^payments")
+
+		assert.SliceEquals(t, []string{"configmap/payments-db", "secret/payments-db"}, resourceNames(resources))
+	})
+
+	t.Run("find stops fetching kinds once matches are found", func(t *testing.T) {
+		resources, skipped := fetch(t, "find", "-p", "1", "^payments")
+
+		assert.SliceEquals(t, []string{"configmap/payments-db"}, resourceNames(resources))
+		assert.Equals(t, 2, skipped)
+	})
+
+	t.Run("find searches every kind until matches are found", func(t *testing.T) {
+		resources, skipped := fetch(t, "find", "-p", "1", "^api$")
+
+		assert.SliceEquals(t, []string{"service/api"}, resourceNames(resources))
+		assert.Equals(t, 0, skipped)
+		resources, skipped = fetch(t, "find", "-p", "1", "^missing$")
+
+		assert.Equals(t, 0, len(resources))
+		assert.Equals(t, 0, skipped)
+	})
+
+	t.Run("find stops fetching the kinds of each context on its own", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"find", "--contexts", "dev,prod", "-p", "1", "^payments"})
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 6)
+		plugin, err := cmd.NewPlugin(&mockKubeClient{}, opts, ui)
+		assert.Nil(t, err)
+		plugin.NewKubeClient = func(kubeContext string) cmd.KubeClient {
+			kubeClient := newKubeClient()
+			if kubeContext == "prod" {
+				// only the last kind matches in prod
+				kubeClient.getResources.output = map[string][]*kubectl.Resource{
+					"service": {newResource("v1", "Service", "default", "payments-db")},
+				}
+			}
+			return kubeClient
+		}
+
+		resources, err := plugin.Fetch(context.Background())
+
+		assert.Nil(t, err)
+		var actual []string
+		for _, resource := range resources {
+			actual = append(actual, resource.Cluster+":"+resource.String())
+		}
+		assert.SliceEquals(t, []string{"dev:configmap/payments-db", "prod:service/payments-db"}, actual)
+	})
+}
+
+func TestPlugin_Fetch_Age(t *testing.T) {
+	t.Parallel()
+	fetch := func(t *testing.T, args ...string) []*kubectl.Resource {
+		t.Helper()
+		created := func(name string, age time.Duration) *kubectl.Resource {
+			resource := newResource("v1", "ConfigMap", "default", name)
+			resource.Metadata.CreationTimestamp = now.Add(-age)
+			return resource
+		}
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmap"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmap": {
+				created("just-deployed", 10*time.Minute),
+				created("yesterday", 26*time.Hour),
+				created("stale", 45*24*time.Hour),
+			},
+		}
+		opts, err := cmd.GetOptions(args)
+		assert.Nil(t, err)
+		ui := &mockUI{}
+		ui.updates = make(chan *terminal.GetResourcesUpdate, 1)
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		plugin.Now = func() time.Time { return now }
+		resources, err := plugin.Fetch(context.Background())
+		assert.Nil(t, err)
+		return resources
+	}
+
+	t.Run("only returns the resources older than the duration", func(t *testing.T) {
+		resources := fetch(t, "--older-than", "30d")
+
+		assert.SliceEquals(t, []string{"configmap/stale"}, resourceNames(resources))
+	})
+
+	t.Run("only returns the resources newer than the duration", func(t *testing.T) {
+		resources := fetch(t, "--newer-than", "2h")
+
+		assert.SliceEquals(t, []string{"configmap/just-deployed"}, resourceNames(resources))
+	})
+
+	t.Run("combines both durations", func(t *testing.T) {
+		resources := fetch(t, "--older-than", "1h", "--newer-than", "1d12h")
+
+		assert.SliceEquals(t, []string{"configmap/yesterday"}, resourceNames(resources))
+	})
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/jsonpath"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// validateTemplate returns an error when the template of the go-template or
+// jsonpath output format is missing or can't be parsed, so that it's
+// reported before fetching anything.
+func validateTemplate(format, text string) error {
+	if text == "" {
+		return fmt.Errorf("-o %s requires a template, e.g. -o %s=TEMPLATE", format, format)
+	}
+	var err error
+	if format == OutputGoTemplate {
+		_, err = template.New(format).Parse(text)
+	} else {
+		_, err = jsonpath.Parse(text)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s template: %w", format, err)
+	}
+	return nil
+}
+
+// templateData returns the records of the resources as the items of a list,
+// the same shape as the output of `kubectl get -o json`, decoded into maps so
+// that the templates use the json field names, e.g. {{.name}}.
+func templateData(resources []*kubectl.Resource) (any, error) {
+	data, err := json.Marshal(map[string]any{"items": newRecords(resources)})
+	if err != nil {
+		return nil, err
+	}
+	var list any
+	err = json.Unmarshal(data, &list)
+	return list, err
+}
+
+// printGoTemplate writes the resources with a text/template, e.g.
+// {{range .items}}{{.namespace}}/{{.name}}{{"\n"}}{{end}}
+func printGoTemplate(w io.Writer, resources []*kubectl.Resource, text string) error {
+	tmpl, err := template.New(OutputGoTemplate).Parse(text)
+	if err != nil {
+		return err
+	}
+	data, err := templateData(resources)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
+
+// printJSONPath writes the resources with a JSONPath template, e.g.
+// {range .items[*]}{.namespace}/{.name}{"\n"}{end}
+func printJSONPath(w io.Writer, resources []*kubectl.Resource, text string) error {
+	path, err := jsonpath.Parse(text)
+	if err != nil {
+		return err
+	}
+	data, err := templateData(resources)
+	if err != nil {
+		return err
+	}
+	return path.Execute(w, data)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// argoCDInstanceLabel is the label with which Argo CD tracks the resources of
+// an Application by default, its value is the name of the Application, or
+// <namespace>_<name> for the Applications outside of the Argo CD namespace.
+const argoCDInstanceLabel = "app.kubernetes.io/instance"
+
+// printTree writes the resources as trees that follow their ownerReferences,
+// e.g. deployment → replicaset → pod. The resources without owners, or whose
+// owners weren't found, are under the Argo CD Application that tracks them by
+// its label, if any, or else at the root. The order of the resources is kept
+// among siblings.
+func (c *Cmd) printTree(w io.Writer, resources []*kubectl.Resource) error {
+	byUID := make(map[string]*kubectl.Resource, len(resources))
+	applications := make(map[string]*kubectl.Resource)
+	for _, resource := range resources {
+		if uid := resource.Metadata.UID; uid != "" {
+			byUID[resource.Cluster+"/"+uid] = resource
+		}
+		if resource.Group() == "argoproj.io" && resource.Kind == "Application" {
+			applications[resource.Cluster+"/"+resource.Name()] = resource
+			applications[resource.Cluster+"/"+resource.Namespace()+"_"+resource.Name()] = resource
+		}
+	}
+	dependents := make(map[*kubectl.Resource][]*kubectl.Resource)
+	var roots []*kubectl.Resource
+	for _, resource := range resources {
+		owner := findOwner(resource, byUID)
+		if owner == nil {
+			owner = findApplication(resource, applications)
+		}
+		if owner != nil {
+			dependents[owner] = append(dependents[owner], resource)
+		} else {
+			roots = append(roots, resource)
+		}
+	}
+	visited := make(map[*kubectl.Resource]bool, len(resources))
+	var writeTree func(resource, owner *kubectl.Resource, prefix, childPrefix string) error
+	writeTree = func(resource, owner *kubectl.Resource, prefix, childPrefix string) error {
+		visited[resource] = true
+		if _, err := io.WriteString(w, prefix+c.treeLabel(resource, owner)+"\n"); err != nil {
+			return err
+		}
+		children := dependents[resource]
+		for i, child := range children {
+			if visited[child] {
+				continue
+			}
+			branch, indent := "├── ", "│   "
+			if i == len(children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			if err := writeTree(child, resource, childPrefix+branch, childPrefix+indent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := writeTree(root, nil, "", ""); err != nil {
+			return err
+		}
+	}
+	// the resources in an ownership cycle can't be reached from the roots
+	for _, resource := range resources {
+		if !visited[resource] {
+			if err := writeTree(resource, nil, "", ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findOwner returns the controller of the resource, or its first owner, among
+// the resources indexed by cluster and uid. It returns nil when none of the
+// owners were found.
+func findOwner(resource *kubectl.Resource, byUID map[string]*kubectl.Resource) *kubectl.Resource {
+	var owner *kubectl.Resource
+	for _, ref := range resource.Metadata.OwnerReferences {
+		candidate, found := byUID[resource.Cluster+"/"+ref.UID]
+		if !found || candidate == resource {
+			continue
+		}
+		if ref.Controller != nil && *ref.Controller {
+			return candidate
+		}
+		if owner == nil {
+			owner = candidate
+		}
+	}
+	return owner
+}
+
+// findApplication returns the Argo CD Application that tracks the resource by
+// its argoCDInstanceLabel, among the Applications indexed by cluster and
+// name, or by cluster and <namespace>_<name>. It returns nil when the
+// Application wasn't found.
+func findApplication(resource *kubectl.Resource, applications map[string]*kubectl.Resource) *kubectl.Resource {
+	instance := resource.Metadata.Labels[argoCDInstanceLabel]
+	if instance == "" {
+		return nil
+	}
+	if application := applications[resource.Cluster+"/"+instance]; application != resource {
+		return application
+	}
+	return nil
+}
+
+// treeLabel returns the resource as formatted by formatName at the root of a
+// tree. Below its owner, the resource is only prefixed by its namespace when
+// it's not the namespace of its owner, e.g. for a cluster-scoped owner.
+func (c *Cmd) treeLabel(resource, owner *kubectl.Resource) string {
+	if owner == nil {
+		return c.formatName(resource)
+	}
+	if namespace := resource.Namespace(); namespace != "" && namespace != owner.Namespace() {
+		return namespace + "/" + resource.String()
+	}
+	return resource.String()
+}
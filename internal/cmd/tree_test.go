@@ -0,0 +1,102 @@
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+// newOwnedResource returns a resource with the given uid, owned by the given
+// owners.
+func newOwnedResource(apiVersion, kind, namespace, name, uid string, owners ...*kubectl.Resource) *kubectl.Resource {
+	resource := newResource(apiVersion, kind, namespace, name)
+	resource.Metadata.UID = uid
+	controller := true
+	for _, owner := range owners {
+		resource.Metadata.OwnerReferences = append(resource.Metadata.OwnerReferences, kubectl.OwnerReference{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Name:       owner.Name(),
+			UID:        owner.Metadata.UID,
+			Controller: &controller,
+		})
+	}
+	return resource
+}
+
+func TestCmd_Run_TreeOutput(t *testing.T) {
+	t.Parallel()
+	t.Run("renders the resources under their owners", func(t *testing.T) {
+		deployment := newOwnedResource("apps/v1", "Deployment", "default", "web", "1")
+		replicaSet := newOwnedResource("apps/v1", "ReplicaSet", "default", "web-5d8f7c", "2", deployment)
+		oldReplicaSet := newOwnedResource("apps/v1", "ReplicaSet", "default", "web-6b9d4f", "3", deployment)
+		pod1 := newOwnedResource("v1", "Pod", "default", "web-5d8f7c-a", "4", replicaSet)
+		pod2 := newOwnedResource("v1", "Pod", "default", "web-5d8f7c-b", "5", replicaSet)
+		configMap := newOwnedResource("v1", "ConfigMap", "default", "settings", "6")
+		// its owner wasn't fetched
+		job := newOwnedResource("batch/v1", "Job", "default", "backup-27600", "7", newOwnedResource("batch/v1", "CronJob", "default", "backup", "8"))
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputTree}, configMap, deployment, job, pod1, pod2, replicaSet, oldReplicaSet)
+
+		expected := `configmap/settings
+deployment.apps/web
+├── replicaset.apps/web-5d8f7c
+│   ├── pod/web-5d8f7c-a
+│   └── pod/web-5d8f7c-b
+└── replicaset.apps/web-6b9d4f
+job.batch/backup-27600
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("prefixes the dependents of cluster-scoped owners with their namespace", func(t *testing.T) {
+		tenant := newOwnedResource("example.com/v1", "Tenant", "", "shop", "1")
+		service := newOwnedResource("v1", "Service", "shop", "frontend", "2", tenant)
+		configMap := newOwnedResource("v1", "ConfigMap", "shop", "settings", "3", tenant)
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputTree, AllNamespaces: true, IncludeNonNamespaced: true}, tenant, configMap, service)
+
+		expected := `tenant.example.com/shop
+├── shop/configmap/settings
+└── shop/service/frontend
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("renders the resources tracked by an Argo CD Application under it", func(t *testing.T) {
+		tracked := func(resource *kubectl.Resource, instance string) *kubectl.Resource {
+			resource.Metadata.Labels = map[string]string{"app.kubernetes.io/instance": instance}
+			return resource
+		}
+		shop := newOwnedResource("argoproj.io/v1alpha1", "Application", "argocd", "shop", "1")
+		api := tracked(newOwnedResource("argoproj.io/v1alpha1", "Application", "team-a", "api", "2"), "shop")
+		deployment := tracked(newOwnedResource("apps/v1", "Deployment", "shop", "web", "3"), "shop")
+		// its owner comes first
+		replicaSet := tracked(newOwnedResource("apps/v1", "ReplicaSet", "shop", "web-5d8f7c", "4", deployment), "shop")
+		service := tracked(newOwnedResource("v1", "Service", "team-a", "api", "5"), "team-a_api")
+		configMap := tracked(newOwnedResource("v1", "ConfigMap", "shop", "settings", "6"), "other")
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputTree, AllNamespaces: true}, api, shop, deployment, replicaSet, service, configMap)
+
+		expected := `argocd/application.argoproj.io/shop
+├── team-a/application.argoproj.io/api
+│   └── service/api
+└── shop/deployment.apps/web
+    └── replicaset.apps/web-5d8f7c
+shop/configmap/settings
+`
+		assert.Equals(t, expected, actual)
+	})
+
+	t.Run("keeps the resources of an ownership cycle", func(t *testing.T) {
+		a := newOwnedResource("v1", "ConfigMap", "default", "a", "1")
+		b := newOwnedResource("v1", "ConfigMap", "default", "b", "2", a)
+		a.Metadata.OwnerReferences = newOwnedResource("v1", "ConfigMap", "default", "a", "1", b).Metadata.OwnerReferences
+
+		actual := runWithOutput(t, &cmd.Options{Output: cmd.OutputTree}, a, b)
+
+		assert.Equals(t, "configmap/a\n└── configmap/b\n", actual)
+	})
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
+)
+
+// Watch event types
+const (
+	WatchCreated = "created"
+	WatchDeleted = "deleted"
+	WatchFailed  = "failed"
+)
+
+// WatchEvent is a resource that was created or deleted while watching, or,
+// when its Type is WatchFailed, the failure to list a kind again.
+type WatchEvent struct {
+	Type     string
+	Resource *kubectl.Resource
+	Err      *FetchError
+}
+
+// Watch lists the kinds of the last fetch again every WatchInterval and sends
+// the resources created and deleted since the previous listing on the
+// `events` channel, until the context is done. The kinds aren't discovered
+// again and the listings share the MaxInFlight budget. A kind that can't be
+// listed is skipped until the next listing, its failure is sent once, when it
+// starts failing. The channel is closed when Watch returns.
+func (p *Plugin) Watch(ctx context.Context, events chan<- *WatchEvent) error {
+	defer close(events)
+	if p.watchTasks == nil {
+		return errors.New("nothing to watch, the resources must be fetched first")
+	}
+	maxParallel := make(chan struct{}, p.options.MaxInFlight)
+	// the kinds that failed to be fetched were already reported
+	failing := make(map[*fetchTask]bool)
+	for _, task := range p.watchTasks {
+		if _, known := p.snapshots[task]; !known {
+			failing[task] = true
+		}
+	}
+	send := func(event *WatchEvent) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	ticker := time.NewTicker(p.options.WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		listings, errs := p.relist(ctx, maxParallel)
+		if ctx.Err() != nil {
+			return nil
+		}
+		for _, task := range p.watchTasks {
+			if err, failed := errs[task]; failed {
+				if !failing[task] {
+					failing[task] = true
+					failure := &FetchError{Cluster: task.cluster, Namespace: task.namespace, Kind: task.kind, Err: err}
+					if !send(&WatchEvent{Type: WatchFailed, Err: failure}) {
+						return nil
+					}
+				}
+				continue
+			}
+			resources, listed := listings[task]
+			if !listed {
+				continue
+			}
+			delete(failing, task)
+			previous, known := p.snapshots[task]
+			p.snapshots[task] = resources
+			if !known {
+				// the kind couldn't be listed until now, there's nothing to
+				// compare with
+				continue
+			}
+			for _, event := range watchEvents(previous, resources) {
+				if !send(event) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// relist lists the resources of every watched task concurrently, using the
+// maxParallel semaphore to limit the number of concurrent calls. The tasks
+// that failed are missing from the returned listings, their errors are
+// returned instead.
+func (p *Plugin) relist(ctx context.Context, maxParallel chan struct{}) (map[*fetchTask][]*kubectl.Resource, map[*fetchTask]error) {
+	listings := make(map[*fetchTask][]*kubectl.Resource, len(p.watchTasks))
+	errs := make(map[*fetchTask]error)
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for _, task := range p.watchTasks {
+		select {
+		case maxParallel <- struct{}{}:
+		case <-ctx.Done():
+			return listings, errs
+		}
+		task := task
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-maxParallel }()
+			resources, err := task.getResources(ctx, task.kind)
+			var notSupportedErr *kubectl.FieldSelectorNotSupportedError
+			if err != nil && !errors.As(err, &notSupportedErr) {
+				if ctx.Err() == nil {
+					mu.Lock()
+					defer mu.Unlock()
+					errs[task] = err
+				}
+				return
+			}
+			resources = p.options.filterResources(resources, p.fetchedAt)
+			for _, resource := range resources {
+				resource.Cluster = task.cluster
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			listings[task] = resources
+		}()
+	}
+	return listings, errs
+}
+
+// watchEvents returns the events of the resources that are only in the
+// current listing, followed by the ones that are only in the previous
+// listing. A resource that was deleted and created again with the same name
+// has another uid, so it's reported as deleted and created.
+func watchEvents(previous, current []*kubectl.Resource) []*WatchEvent {
+	key := func(resource *kubectl.Resource) string {
+		return resource.Namespace() + "/" + resource.Name() + "/" + resource.Metadata.UID
+	}
+	previousKeys := make(map[string]bool, len(previous))
+	for _, resource := range previous {
+		previousKeys[key(resource)] = true
+	}
+	currentKeys := make(map[string]bool, len(current))
+	var events []*WatchEvent
+	for _, resource := range current {
+		currentKeys[key(resource)] = true
+		if !previousKeys[key(resource)] {
+			events = append(events, &WatchEvent{Type: WatchCreated, Resource: resource})
+		}
+	}
+	for _, resource := range previous {
+		if !currentKeys[key(resource)] {
+			events = append(events, &WatchEvent{Type: WatchDeleted, Resource: resource})
+		}
+	}
+	return events
+}
+
+// watch prints the resources found, then prints the resources created and
+// deleted until the context is done. When connected to a TTY, the events
+// are displayed in a live feed and printed once the watch stops.
+func (c *Cmd) watch(ctx context.Context) error {
+	resources, partialErr, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.printResources(resources); err != nil {
+		return err
+	}
+	// the watch keeps going, the failure is only returned when it stops
+	partialFailure := c.reportPartialFailure(partialErr)
+
+	fileInfo, err := c.stdout.Stat()
+	if err != nil {
+		return err
+	}
+	events := make(chan *WatchEvent)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- c.plugin.Watch(ctx, events)
+	}()
+	isTTY := fileInfo.Mode()&os.ModeCharDevice != 0
+	wg := &sync.WaitGroup{}
+	feed := make(chan *terminal.WatchEvent)
+	if isTTY {
+		wg.Add(1)
+		go c.ui.Feed(ctx, wg, feed)
+	}
+	// when connected to a TTY, the events and the failures are printed after
+	// the live feed
+	var stdout, stderr io.Writer = c.stdout, c.stderr
+	pending, pendingFailures := &bytes.Buffer{}, &bytes.Buffer{}
+	if isTTY {
+		stdout, stderr = pending, pendingFailures
+	}
+	var printErr error
+	for event := range events {
+		if printErr != nil {
+			// keep receiving so that Watch can return
+			continue
+		}
+		if event.Type == WatchFailed {
+			fmt.Fprintf(stderr, "Could not list %s again, it's skipped until it can be listed: %v\n", failedKindName(event.Err), event.Err)
+			continue
+		}
+		created := event.Type == WatchCreated
+		name := c.formatName(event.Resource)
+		if printErr = c.printWatchEvent(stdout, event, name); printErr != nil || !isTTY {
+			continue
+		}
+		select {
+		case feed <- &terminal.WatchEvent{Time: c.Now(), Created: created, Kind: kindOf(event.Resource), Name: name}:
+		case <-ctx.Done():
+		}
+	}
+	close(feed)
+	c.waitForUI(wg)
+	if err := <-watchErr; err != nil {
+		return err
+	}
+	if printErr != nil {
+		return printErr
+	}
+	if _, err := pending.WriteTo(c.stdout); err != nil {
+		return err
+	}
+	pendingFailures.WriteTo(c.stderr)
+	return partialFailure
+}
+
+// watchRecord is the record of a resource created or deleted, as written by
+// --watch with -o ndjson.
+type watchRecord struct {
+	Event string `json:"event"`
+	*Record
+}
+
+// printWatchEvent writes the event, as a record with -o ndjson, otherwise as
+// the name of the resource prefixed by + when it was created or - when it was
+// deleted.
+func (c *Cmd) printWatchEvent(w io.Writer, event *WatchEvent, name string) error {
+	if c.options.Output == OutputNDJSON {
+		return json.NewEncoder(w).Encode(&watchRecord{Event: event.Type, Record: newRecord(event.Resource)})
+	}
+	sign := "-"
+	if event.Type == WatchCreated {
+		sign = "+"
+	}
+	_, err := fmt.Fprintln(w, sign+" "+name)
+	return err
+}
+
+// failedKindName returns the kind that failed, with its namespace and its
+// context between brackets when it has them.
+func failedKindName(failure *FetchError) string {
+	name := failure.Kind
+	if failure.Namespace != "" {
+		name += " in " + failure.Namespace
+	}
+	if failure.Cluster != "" {
+		name = "[" + failure.Cluster + "] " + name
+	}
+	return name
+}
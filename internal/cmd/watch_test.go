@@ -0,0 +1,262 @@
+package cmd_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestPlugin_Watch(t *testing.T) {
+	t.Parallel()
+
+	newUIDResource := func(apiVersion, kind, namespace, name, uid string) *kubectl.Resource {
+		resource := newResource(apiVersion, kind, namespace, name)
+		resource.Metadata.UID = uid
+		return resource
+	}
+
+	t.Run("reports the resources created and deleted since the previous listing", func(t *testing.T) {
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmaps", "pods"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {newUIDResource("v1", "ConfigMap", "default", "settings", "1")},
+			"pods": {
+				newUIDResource("v1", "Pod", "default", "web-0", "2"),
+				newUIDResource("v1", "Pod", "default", "web-1", "3"),
+			},
+		}
+		opts, err := cmd.GetOptions([]string{"--watch", "--watch-interval", "1ms"})
+		assert.Nil(t, err)
+		ui := &mockUI{updates: make(chan *terminal.GetResourcesUpdate, 2)}
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err = plugin.Fetch(ctx)
+		assert.Nil(t, err)
+
+		kubeClient.getResources.mu.Lock()
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {newUIDResource("v1", "ConfigMap", "default", "settings", "1")},
+			"pods": {
+				// web-0 was deleted and created again
+				newUIDResource("v1", "Pod", "default", "web-0", "4"),
+				newUIDResource("v1", "Pod", "default", "web-2", "5"),
+			},
+		}
+		kubeClient.getResources.mu.Unlock()
+		events := make(chan *cmd.WatchEvent)
+		watchErr := make(chan error, 1)
+		go func() {
+			watchErr <- plugin.Watch(ctx, events)
+		}()
+		var actual []string
+		for event := range events {
+			actual = append(actual, event.Type+" "+event.Resource.String()+" "+event.Resource.Metadata.UID)
+			if len(actual) == 4 {
+				cancel()
+			}
+		}
+
+		assert.Nil(t, <-watchErr)
+		expected := []string{
+			"created pod/web-0 4",
+			"created pod/web-2 5",
+			"deleted pod/web-0 2",
+			"deleted pod/web-1 3",
+		}
+		assert.SliceEquals(t, expected, actual)
+	})
+
+	t.Run("filters the resources by their age at the time of the fetch", func(t *testing.T) {
+		created := func(name, uid string, age time.Duration) *kubectl.Resource {
+			resource := newUIDResource("v1", "ConfigMap", "default", name, uid)
+			resource.Metadata.CreationTimestamp = now.Add(-age)
+			return resource
+		}
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmaps"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {created("old", "1", 2*time.Hour), created("aging", "2", 59*time.Minute)},
+		}
+		opts, err := cmd.GetOptions([]string{"--watch", "--watch-interval", "1ms", "--older-than", "1h"})
+		assert.Nil(t, err)
+		ui := &mockUI{updates: make(chan *terminal.GetResourcesUpdate, 1)}
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		clock := now
+		plugin.Now = func() time.Time { return clock }
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resources, err := plugin.Fetch(ctx)
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"configmap/old"}, resourceNames(resources))
+
+		// aging is now older than an hour, which doesn't make it new
+		clock = now.Add(time.Hour)
+		kubeClient.getResources.mu.Lock()
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {created("old", "1", 2*time.Hour), created("aging", "2", 59*time.Minute), created("older", "3", 3*time.Hour)},
+		}
+		kubeClient.getResources.mu.Unlock()
+		events := make(chan *cmd.WatchEvent)
+		watchErr := make(chan error, 1)
+		go func() {
+			watchErr <- plugin.Watch(ctx, events)
+		}()
+		var actual []string
+		for event := range events {
+			actual = append(actual, event.Type+" "+event.Resource.String())
+			// let a few more listings report aging, if they do
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}
+
+		assert.Nil(t, <-watchErr)
+		assert.SliceEquals(t, []string{"created configmap/older"}, actual)
+	})
+
+	t.Run("reports the kinds that can't be listed again once", func(t *testing.T) {
+		kubeClient := &mockKubeClient{}
+		kubeClient.listApiResources.output = []string{"configmaps", "pods"}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {newUIDResource("v1", "ConfigMap", "default", "settings", "1")},
+			"pods":       {newUIDResource("v1", "Pod", "default", "web-0", "2")},
+		}
+		opts, err := cmd.GetOptions([]string{"--watch", "--watch-interval", "1ms"})
+		assert.Nil(t, err)
+		ui := &mockUI{updates: make(chan *terminal.GetResourcesUpdate, 2)}
+		plugin, err := cmd.NewPlugin(kubeClient, opts, ui)
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err = plugin.Fetch(ctx)
+		assert.Nil(t, err)
+
+		kubeClient.getResources.mu.Lock()
+		kubeClient.getResources.errs = map[string]error{"pods": errors.New("forbidden")}
+		kubeClient.getResources.output = map[string][]*kubectl.Resource{
+			"configmaps": {
+				newUIDResource("v1", "ConfigMap", "default", "settings", "1"),
+				newUIDResource("v1", "ConfigMap", "default", "other", "3"),
+			},
+		}
+		kubeClient.getResources.mu.Unlock()
+		events := make(chan *cmd.WatchEvent)
+		watchErr := make(chan error, 1)
+		go func() {
+			watchErr <- plugin.Watch(ctx, events)
+		}()
+		var actual []string
+		for event := range events {
+			if event.Type == cmd.WatchFailed {
+				actual = append(actual, event.Type+" "+event.Err.Kind+" "+event.Err.Error())
+			} else {
+				actual = append(actual, event.Type+" "+event.Resource.String())
+			}
+			if len(actual) == 2 {
+				// let a few more listings fail
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}
+		}
+
+		assert.Nil(t, <-watchErr)
+		sort.Strings(actual)
+		assert.SliceEquals(t, []string{"created configmap/other", "failed pods forbidden"}, actual)
+	})
+
+	t.Run("returns an error when nothing was fetched", func(t *testing.T) {
+		opts, err := cmd.GetOptions([]string{"--watch"})
+		assert.Nil(t, err)
+		plugin, err := cmd.NewPlugin(&mockKubeClient{}, opts, &mockUI{})
+		assert.Nil(t, err)
+		assert.NotNil(t, plugin.Watch(context.Background(), make(chan *cmd.WatchEvent)))
+	})
+}
+
+func TestCmd_Run_Watch(t *testing.T) {
+	t.Parallel()
+	fetcher := func() *mockFetcher {
+		return &mockFetcher{
+			resources: []*kubectl.Resource{newResource("v1", "Pod", "default", "web-0")},
+			events: []*cmd.WatchEvent{
+				{Type: cmd.WatchCreated, Resource: newResource("v1", "Pod", "default", "web-1")},
+				{Type: cmd.WatchDeleted, Resource: newResource("apps/v1", "Deployment", "default", "api")},
+			},
+		}
+	}
+
+	t.Run("prints the events after the resources", func(t *testing.T) {
+		stdout := &mockStdout{}
+		ui := &mockStarter{}
+		c, err := cmd.NewCmd(fetcher(), &cmd.Options{Watch: true}, stdout, &strings.Builder{}, ui)
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, "pod/web-0\n+ pod/web-1\n- deployment.apps/api\n", stdout.builder.String())
+		assert.Equals(t, 0, len(ui.feed))
+	})
+
+	t.Run("prints the events as records with ndjson", func(t *testing.T) {
+		stdout := &mockStdout{}
+		c, err := cmd.NewCmd(fetcher(), &cmd.Options{Watch: true, Output: cmd.OutputNDJSON}, stdout, &strings.Builder{}, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		expected := `{"group":"","version":"v1","kind":"Pod","resource":"","namespace":"default","name":"web-0"}
+{"event":"created","group":"","version":"v1","kind":"Pod","resource":"","namespace":"default","name":"web-1"}
+{"event":"deleted","group":"apps","version":"v1","kind":"Deployment","resource":"","namespace":"default","name":"api"}
+`
+		assert.Equals(t, expected, stdout.builder.String())
+	})
+
+	t.Run("prints the kinds that can't be listed again on stderr", func(t *testing.T) {
+		fetcher := fetcher()
+		fetcher.events = append(fetcher.events, &cmd.WatchEvent{
+			Type: cmd.WatchFailed,
+			Err:  &cmd.FetchError{Cluster: "prod", Namespace: "default", Kind: "secrets", Err: errors.New("forbidden")},
+		})
+		stdout := &mockStdout{}
+		stderr := &strings.Builder{}
+		c, err := cmd.NewCmd(fetcher, &cmd.Options{Watch: true}, stdout, stderr, &mockStarter{})
+		assert.Nil(t, err)
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, "pod/web-0\n+ pod/web-1\n- deployment.apps/api\n", stdout.builder.String())
+		assert.Equals(t, "Could not list [prod] secrets in default again, it's skipped until it can be listed: forbidden\n", stderr.String())
+	})
+
+	t.Run("displays the events in the live feed when connected to a TTY", func(t *testing.T) {
+		stdout := &mockStdout{}
+		stdout.fileInfo.mode = fs.ModeCharDevice
+		ui := &mockStarter{}
+		c, err := cmd.NewCmd(fetcher(), &cmd.Options{Watch: true}, stdout, &strings.Builder{}, ui)
+		assert.Nil(t, err)
+		now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+		c.Now = func() time.Time { return now }
+
+		err = c.Run(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equals(t, 2, len(ui.feed))
+		assert.Equals(t, terminal.WatchEvent{Time: now, Created: true, Kind: "pod", Name: "pod/web-1"}, *ui.feed[0])
+		assert.Equals(t, terminal.WatchEvent{Time: now, Kind: "deployment.apps", Name: "deployment.apps/api"}, *ui.feed[1])
+		assert.Equals(t, "pod/web-0\n+ pod/web-1\n- deployment.apps/api\n", stdout.builder.String())
+	})
+}
@@ -0,0 +1,131 @@
+// Package discovery caches the API resources of the clusters on disk, so
+// that repeated runs don't need to discover them again.
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultTTL is how long the API resources of a cluster are cached by
+// default, like the discovery cache of kubectl.
+const DefaultTTL = 10 * time.Minute
+
+// Cache stores the API resources of each cluster in a file, keyed by the URL
+// of the API server of the cluster.
+type Cache struct {
+	dir string
+	ttl time.Duration
+	// Refresh makes the cache ignore the cached API resources, the API
+	// resources are still written to the cache.
+	Refresh bool
+	// Now returns the current time, it's used to expire the cached API
+	// resources
+	Now func() time.Time
+}
+
+// NewCache returns a Cache that stores the API resources in the given
+// directory for the duration of the `ttl`.
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{
+		dir: dir,
+		ttl: ttl,
+		Now: time.Now,
+	}
+}
+
+// DefaultDir returns the directory of the cache in the cache directory of the
+// user, e.g. ~/.cache/kubectl-fetch/discovery
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "kubectl-fetch", "discovery"), nil
+}
+
+// entry is the content of a cache file.
+type entry struct {
+	Server       string    `json:"server"`
+	Namespaced   bool      `json:"namespaced"`
+	Timestamp    time.Time `json:"timestamp"`
+	APIResources []string  `json:"apiResources"`
+}
+
+func (c *Cache) path(server string, namespaced bool) string {
+	sum := sha256.Sum256([]byte(server))
+	scope := "cluster"
+	if namespaced {
+		scope = "namespaced"
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+"-"+scope+".json")
+}
+
+// Get returns the cached namespaced or non-namespaced API resources of the
+// server. It returns false when they aren't cached, when they have expired or
+// when refreshing the cache.
+func (c *Cache) Get(server string, namespaced bool) ([]string, bool) {
+	if c.Refresh {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(server, namespaced))
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	if e.Server != server || e.Namespaced != namespaced || c.Now().Sub(e.Timestamp) > c.ttl {
+		return nil, false
+	}
+	return e.APIResources, true
+}
+
+// Set writes the namespaced or non-namespaced API resources of the server to
+// the cache.
+func (c *Cache) Set(server string, namespaced bool, apiResources []string) error {
+	data, err := json.Marshal(&entry{
+		Server:       server,
+		Namespaced:   namespaced,
+		Timestamp:    c.Now(),
+		APIResources: apiResources,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first, so that concurrent runs never read a
+	// partially written file
+	file, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.path(server, namespaced))
+}
+
+// Delete removes the namespaced and non-namespaced API resources of the
+// server from the cache.
+func (c *Cache) Delete(server string) error {
+	for _, namespaced := range []bool{true, false} {
+		if err := os.Remove(c.path(server, namespaced)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package discovery_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/discovery"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+	newCache := func(t *testing.T) *discovery.Cache {
+		cache := discovery.NewCache(t.TempDir(), time.Hour)
+		cache.Now = func() time.Time { return now }
+		return cache
+	}
+
+	t.Run("returns the cached API resources of the server", func(t *testing.T) {
+		cache := newCache(t)
+		assert.Nil(t, cache.Set("https://a.example.com", true, []string{"pods", "services"}))
+		assert.Nil(t, cache.Set("https://a.example.com", false, []string{"nodes"}))
+		apiResources, found := cache.Get("https://a.example.com", true)
+		assert.True(t, found)
+		assert.SliceEquals(t, []string{"pods", "services"}, apiResources)
+		apiResources, found = cache.Get("https://a.example.com", false)
+		assert.True(t, found)
+		assert.SliceEquals(t, []string{"nodes"}, apiResources)
+		_, found = cache.Get("https://b.example.com", true)
+		assert.True(t, !found)
+	})
+
+	t.Run("expires the API resources after the ttl", func(t *testing.T) {
+		cache := newCache(t)
+		assert.Nil(t, cache.Set("https://a.example.com", true, []string{"pods"}))
+		cache.Now = func() time.Time { return now.Add(59 * time.Minute) }
+		_, found := cache.Get("https://a.example.com", true)
+		assert.True(t, found)
+		cache.Now = func() time.Time { return now.Add(61 * time.Minute) }
+		_, found = cache.Get("https://a.example.com", true)
+		assert.True(t, !found)
+	})
+
+	t.Run("ignores the cached API resources when refreshing", func(t *testing.T) {
+		cache := newCache(t)
+		assert.Nil(t, cache.Set("https://a.example.com", true, []string{"pods"}))
+		cache.Refresh = true
+		_, found := cache.Get("https://a.example.com", true)
+		assert.True(t, !found)
+		assert.Nil(t, cache.Set("https://a.example.com", true, []string{"pods", "services"}))
+		cache.Refresh = false
+		apiResources, found := cache.Get("https://a.example.com", true)
+		assert.True(t, found)
+		assert.SliceEquals(t, []string{"pods", "services"}, apiResources)
+	})
+
+	t.Run("deletes the API resources of the server", func(t *testing.T) {
+		cache := newCache(t)
+		assert.Nil(t, cache.Set("https://a.example.com", true, []string{"pods"}))
+		assert.Nil(t, cache.Set("https://a.example.com", false, []string{"nodes"}))
+		assert.Nil(t, cache.Set("https://b.example.com", true, []string{"pods"}))
+		assert.Nil(t, cache.Delete("https://a.example.com"))
+		_, found := cache.Get("https://a.example.com", true)
+		assert.True(t, !found)
+		_, found = cache.Get("https://a.example.com", false)
+		assert.True(t, !found)
+		_, found = cache.Get("https://b.example.com", true)
+		assert.True(t, found)
+		assert.Nil(t, cache.Delete("https://c.example.com"))
+	})
+}
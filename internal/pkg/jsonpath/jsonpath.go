@@ -0,0 +1,608 @@
+// Package jsonpath implements the subset of the kubectl JSONPath templates
+// needed to format decoded JSON values, e.g.
+// {range .items[*]}{.namespace}/{.name}{"\n"}{end}
+//
+// The supported expressions are fields (.name or ['name']), wildcards (.* or
+// [*]), indexes, slices and unions ([0], [-1], [1:3], [0,2], ['a','b']),
+// recursive descent (..name), filters ([?(@.kind=="Pod")]), ranges and
+// string literals. Like `kubectl get -o jsonpath`, missing keys are ignored.
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a parsed template.
+type JSONPath struct {
+	nodes []node
+}
+
+// node is either a textNode, a *path or a *rangeNode.
+type node any
+
+type textNode string
+
+type rangeNode struct {
+	path  *path
+	nodes []node
+}
+
+// path is a sequence of steps, evaluated from the root when it starts with
+// $, otherwise from the current value, which is the root outside of a range.
+type path struct {
+	fromRoot bool
+	steps    []*step
+}
+
+type stepKind int
+
+const (
+	stepFields stepKind = iota
+	stepWildcard
+	stepIndexes
+	stepSlice
+	stepFilter
+)
+
+type step struct {
+	kind stepKind
+	// recursive is true for recursive descent, e.g. ..name
+	recursive  bool
+	fields     []string
+	indexes    []int
+	start, end *int
+	filter     *filter
+}
+
+// filter is a filter expression, e.g. ?(@.kind=="Pod"). When op is empty,
+// the filter only checks that the left operand exists.
+type filter struct {
+	left  operand
+	op    string
+	right operand
+}
+
+// operand is either a path or a literal.
+type operand struct {
+	path    *path
+	literal any
+}
+
+// Parse parses the template. Like kubectl, a template without any braces is
+// a single expression, e.g. .items[*].name
+func Parse(template string) (*JSONPath, error) {
+	if !strings.Contains(template, "{") {
+		template = "{" + template + "}"
+	}
+	root := &rangeNode{}
+	stack := []*rangeNode{root}
+	for len(template) > 0 {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, textNode(template))
+			break
+		}
+		if start > 0 {
+			stack[len(stack)-1].nodes = append(stack[len(stack)-1].nodes, textNode(template[:start]))
+		}
+		end := closingBrace(template[start:])
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed action in %q", template[start:])
+		}
+		action := strings.TrimSpace(template[start+1 : start+end])
+		template = template[start+end+1:]
+		current := stack[len(stack)-1]
+		switch {
+		case action == "end":
+			if len(stack) == 1 {
+				return nil, errors.New("unexpected end without a range")
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(action, "range "):
+			p, err := parsePath(strings.TrimSpace(strings.TrimPrefix(action, "range ")))
+			if err != nil {
+				return nil, err
+			}
+			r := &rangeNode{path: p}
+			current.nodes = append(current.nodes, r)
+			stack = append(stack, r)
+		case strings.HasPrefix(action, `"`):
+			text, err := strconv.Unquote(action)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string literal %s: %w", action, err)
+			}
+			current.nodes = append(current.nodes, textNode(text))
+		default:
+			p, err := parsePath(action)
+			if err != nil {
+				return nil, err
+			}
+			current.nodes = append(current.nodes, p)
+		}
+	}
+	if len(stack) > 1 {
+		return nil, errors.New("range without an end")
+	}
+	return &JSONPath{nodes: root.nodes}, nil
+}
+
+// closingBrace returns the index of the brace that closes the action at the
+// start of `s`, ignoring the braces in quoted strings.
+func closingBrace(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// pathParser parses a path expression, one step at a time.
+type pathParser struct {
+	expression string
+	pos        int
+}
+
+func parsePath(expression string) (*path, error) {
+	p := &pathParser{expression: expression}
+	result, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(expression) {
+		return nil, p.errorf("unexpected %q", expression[p.pos:])
+	}
+	return result, nil
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid expression %q: %s", p.expression, fmt.Sprintf(format, args...))
+}
+
+func (p *pathParser) peek(prefix string) bool {
+	return strings.HasPrefix(p.expression[p.pos:], prefix)
+}
+
+// parse parses the steps of a path until the end of the expression or a
+// character that can't be part of a path, e.g. an operator in a filter.
+func (p *pathParser) parse() (*path, error) {
+	result := &path{}
+	switch {
+	case p.peek("$"):
+		result.fromRoot = true
+		p.pos++
+	case p.peek("@"):
+		p.pos++
+	}
+	for p.pos < len(p.expression) {
+		var s *step
+		var err error
+		switch {
+		case p.peek(".."):
+			p.pos += 2
+			if s, err = p.parseDotStep(); err != nil {
+				return nil, err
+			}
+			s.recursive = true
+		case p.peek("."):
+			p.pos++
+			if p.pos == len(p.expression) {
+				// a lone dot is the current value
+				return result, nil
+			}
+			if s, err = p.parseDotStep(); err != nil {
+				return nil, err
+			}
+		case p.peek("["):
+			if s, err = p.parseSubscript(); err != nil {
+				return nil, err
+			}
+		default:
+			return result, nil
+		}
+		result.steps = append(result.steps, s)
+	}
+	return result, nil
+}
+
+// parseDotStep parses the field or wildcard after a dot.
+func (p *pathParser) parseDotStep() (*step, error) {
+	if p.peek("*") {
+		p.pos++
+		return &step{kind: stepWildcard}, nil
+	}
+	if p.peek("[") {
+		// e.g. ..[0]
+		return p.parseSubscript()
+	}
+	start := p.pos
+	for p.pos < len(p.expression) && !strings.ContainsRune(".[]()=!<> ", rune(p.expression[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("missing field name at %d", start)
+	}
+	return &step{kind: stepFields, fields: []string{p.expression[start:p.pos]}}, nil
+}
+
+// parseSubscript parses the content of the brackets at the current
+// position.
+func (p *pathParser) parseSubscript() (*step, error) {
+	if p.peek("[?(") {
+		p.pos += 3
+		f, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")]") {
+			return nil, p.errorf("unclosed filter")
+		}
+		p.pos += 2
+		return &step{kind: stepFilter, filter: f}, nil
+	}
+	end := strings.IndexByte(p.expression[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("unclosed bracket")
+	}
+	content := strings.TrimSpace(p.expression[p.pos+1 : p.pos+end])
+	p.pos += end + 1
+	switch {
+	case content == "*":
+		return &step{kind: stepWildcard}, nil
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, `"`):
+		s := &step{kind: stepFields}
+		for _, field := range strings.Split(content, ",") {
+			field = strings.TrimSpace(field)
+			if len(field) < 2 || field[0] != field[len(field)-1] {
+				return nil, p.errorf("invalid field %s", field)
+			}
+			s.fields = append(s.fields, field[1:len(field)-1])
+		}
+		return s, nil
+	case strings.Contains(content, ":"):
+		s := &step{kind: stepSlice}
+		parts := strings.Split(content, ":")
+		if len(parts) > 2 {
+			return nil, p.errorf("slice steps aren't supported")
+		}
+		for i, bound := range []**int{&s.start, &s.end} {
+			if part := strings.TrimSpace(parts[i]); part != "" {
+				n, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, p.errorf("invalid slice bound %q", part)
+				}
+				*bound = &n
+			}
+		}
+		return s, nil
+	default:
+		s := &step{kind: stepIndexes}
+		for _, index := range strings.Split(content, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(index))
+			if err != nil {
+				return nil, p.errorf("invalid index %q", index)
+			}
+			s.indexes = append(s.indexes, n)
+		}
+		return s, nil
+	}
+}
+
+var filterOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *pathParser) parseFilter() (*filter, error) {
+	f := &filter{}
+	var err error
+	if f.left, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	for _, op := range filterOperators {
+		if p.peek(op) {
+			f.op = op
+			p.pos += len(op)
+			p.skipSpaces()
+			if f.right, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+			p.skipSpaces()
+			break
+		}
+	}
+	return f, nil
+}
+
+func (p *pathParser) skipSpaces() {
+	for p.peek(" ") {
+		p.pos++
+	}
+}
+
+func (p *pathParser) parseOperand() (operand, error) {
+	rest := p.expression[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "@") || strings.HasPrefix(rest, "$"):
+		result, err := p.parse()
+		return operand{path: result}, err
+	case strings.HasPrefix(rest, "'") || strings.HasPrefix(rest, `"`):
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return operand{}, p.errorf("unclosed string")
+		}
+		p.pos += end + 2
+		return operand{literal: rest[1 : end+1]}, nil
+	}
+	end := 0
+	for end < len(rest) && !strings.ContainsRune(")=!<> ", rune(rest[end])) {
+		end++
+	}
+	p.pos += end
+	switch literal := rest[:end]; literal {
+	case "true", "false":
+		return operand{literal: literal == "true"}, nil
+	case "":
+		return operand{}, p.errorf("missing operand")
+	default:
+		n, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return operand{}, p.errorf("invalid literal %q", literal)
+		}
+		return operand{literal: n}, nil
+	}
+}
+
+// Execute writes the template applied to `data`, a value decoded from JSON
+// into an `any`.
+func (j *JSONPath) Execute(w io.Writer, data any) error {
+	return execute(w, j.nodes, data, data)
+}
+
+func execute(w io.Writer, nodes []node, root, current any) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			if _, err := io.WriteString(w, string(n)); err != nil {
+				return err
+			}
+		case *path:
+			values := n.evaluate(root, current)
+			formatted := make([]string, 0, len(values))
+			for _, value := range values {
+				text, err := format(value)
+				if err != nil {
+					return err
+				}
+				formatted = append(formatted, text)
+			}
+			if _, err := io.WriteString(w, strings.Join(formatted, " ")); err != nil {
+				return err
+			}
+		case *rangeNode:
+			for _, value := range n.path.evaluate(root, current) {
+				if err := execute(w, n.nodes, root, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// format returns the value as text: strings are written as is, the other
+// values are written as JSON.
+func format(value any) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func (p *path) evaluate(root, current any) []any {
+	values := []any{current}
+	if p.fromRoot {
+		values = []any{root}
+	}
+	for _, s := range p.steps {
+		if s.recursive {
+			values = descendants(values)
+		}
+		var next []any
+		for _, value := range values {
+			next = append(next, s.apply(root, value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+// descendants returns the values and all their descendants.
+func descendants(values []any) []any {
+	var all []any
+	for _, value := range values {
+		all = append(all, value)
+		all = append(all, descendants(children(value))...)
+	}
+	return all
+}
+
+// children returns the elements of an array or the values of an object,
+// sorted by key.
+func children(value any) []any {
+	switch v := value.(type) {
+	case []any:
+		return v
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]any, 0, len(v))
+		for _, key := range keys {
+			values = append(values, v[key])
+		}
+		return values
+	}
+	return nil
+}
+
+func (s *step) apply(root, value any) []any {
+	switch s.kind {
+	case stepFields:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		var values []any
+		for _, field := range s.fields {
+			if v, found := object[field]; found {
+				values = append(values, v)
+			}
+		}
+		return values
+	case stepWildcard:
+		return children(value)
+	case stepIndexes:
+		array, ok := value.([]any)
+		if !ok {
+			return nil
+		}
+		var values []any
+		for _, index := range s.indexes {
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				values = append(values, array[index])
+			}
+		}
+		return values
+	case stepSlice:
+		array, ok := value.([]any)
+		if !ok {
+			return nil
+		}
+		start, end := 0, len(array)
+		if s.start != nil {
+			start = clamp(*s.start, len(array))
+		}
+		if s.end != nil {
+			end = clamp(*s.end, len(array))
+		}
+		if start >= end {
+			return nil
+		}
+		return array[start:end]
+	case stepFilter:
+		var values []any
+		for _, element := range children(value) {
+			if s.filter.matches(root, element) {
+				values = append(values, element)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// clamp returns the slice bound within [0, length], negative bounds are
+// relative to the end.
+func clamp(bound, length int) int {
+	if bound < 0 {
+		bound += length
+	}
+	if bound < 0 {
+		return 0
+	}
+	if bound > length {
+		return length
+	}
+	return bound
+}
+
+func (f *filter) matches(root, element any) bool {
+	left, found := f.left.value(root, element)
+	if f.op == "" {
+		return found
+	}
+	right, rightFound := f.right.value(root, element)
+	if !found || !rightFound {
+		return f.op == "!=" && found != rightFound
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return compare(l < r, l == r, f.op)
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compare(l < r, l == r, f.op)
+		}
+	}
+	equal := fmt.Sprint(left) == fmt.Sprint(right)
+	switch f.op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	}
+	return false
+}
+
+func compare(less, equal bool, op string) bool {
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	}
+	return false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// value returns the literal, or the first value of the path.
+func (o operand) value(root, element any) (any, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	values := o.path.evaluate(root, element)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
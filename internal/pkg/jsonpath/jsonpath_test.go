@@ -0,0 +1,76 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/jsonpath"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+const list = `{
+  "items": [
+    {"kind": "Pod", "namespace": "default", "name": "web-0", "replicas": 1},
+    {"kind": "Deployment", "namespace": "default", "name": "web", "replicas": 3},
+    {"kind": "Namespace", "name": "default", "labels": {"team": "payments"}}
+  ]
+}`
+
+func execute(t *testing.T, template string) string {
+	t.Helper()
+	var data any
+	if err := json.Unmarshal([]byte(list), &data); err != nil {
+		t.Fatal(err)
+	}
+	path, err := jsonpath.Parse(template)
+	assert.Nil(t, err)
+	var output strings.Builder
+	assert.Nil(t, path.Execute(&output, data))
+	return output.String()
+}
+
+func TestJSONPath_Execute(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{.items[*].name}`, "web-0 web default"},
+		{`.items[*].name`, "web-0 web default"},
+		{`{.items[0].name}`, "web-0"},
+		{`{.items[-1].kind}`, "Namespace"},
+		{`{.items[1:].name}`, "web default"},
+		{`{.items[0,2].kind}`, "Pod Namespace"},
+		{`{.items[0]['kind','name']}`, "Pod web-0"},
+		{`{.items[2].labels}`, `{"team":"payments"}`},
+		{`{.items[0].replicas}`, "1"},
+		{`{.items[*].missing}`, ""},
+		{`{..team}`, "payments"},
+		{`{.items[?(@.replicas>1)].name}`, "web"},
+		{`{.items[?(@.kind=="Pod")].name}`, "web-0"},
+		{`{.items[?(@.kind!='Pod')].name}`, "web default"},
+		{`{.items[?(@.namespace)].name}`, "web-0 web"},
+		{`{range .items[*]}{.kind}/{.name}{"\n"}{end}`, "Pod/web-0\nDeployment/web\nNamespace/default\n"},
+		{`{range .items[*]}{.name}{range .items[*]}x{end}{$.items[0].name},{end}`, "web-0web-0,webweb-0,defaultweb-0,"},
+		{`names: {.items[*].name}!`, "names: web-0 web default!"},
+	}
+	for _, test := range tests {
+		assert.Equals(t, test.expected, execute(t, test.template))
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for _, template := range []string{
+		`{.items[*].name`,
+		`{range .items[*]}{.name}`,
+		`{end}`,
+		`{.items[x]}`,
+		`{.items[?(@.name==)]}`,
+		`{"unclosed}`,
+	} {
+		_, err := jsonpath.Parse(template)
+		assert.NotNil(t, err)
+	}
+}
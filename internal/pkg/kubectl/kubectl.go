@@ -1,6 +1,7 @@
 package kubectl
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Cmd is an interface for exec.Cmd to make unit testing easier.
@@ -20,49 +22,323 @@ type CommandContext[C Cmd] func(ctx context.Context, name string, args ...string
 
 type Kubectl[C Cmd] struct {
 	commandContext CommandContext[C]
+	globalFlags    []string
+	// LabelSelector filters the resources returned by kubectl get, e.g.
+	// app=payments
+	LabelSelector string
+	// FieldSelector filters the resources returned by kubectl get, e.g.
+	// status.phase=Running
+	FieldSelector string
+	// FullObjects makes kubectl get return the whole objects, by default only
+	// the fields of Resource are returned, see MetadataTemplate
+	FullObjects bool
+	// DiscoveryCache, when set, is used by ListApiResources to avoid running
+	// kubectl api-resources
+	DiscoveryCache DiscoveryCache
+
+	serverOnce sync.Once
+	server     string
+
+	discoveryMu sync.Mutex
+	// cachedDiscovery is true when the api resources came from the cache
+	cachedDiscovery bool
+	// rediscovered are the api resources discovered again once the cached
+	// ones turned out to be stale
+	rediscovered map[string]bool
+	// rediscoverErr is the error of discovering the api resources again
+	rediscoverErr error
+}
+
+// DiscoveryCache stores the api resources of the clusters, keyed by the URL
+// of their API server.
+type DiscoveryCache interface {
+	Get(server string, namespaced bool) ([]string, bool)
+	Set(server string, namespaced bool, apiResources []string) error
+	// Delete removes the api resources of the server from the cache
+	Delete(server string) error
+}
+
+// FieldSelectorNotSupportedError is returned when getting the resources of a
+// kind that doesn't support the field selector.
+type FieldSelectorNotSupportedError struct {
+	Kind          string
+	FieldSelector string
+}
+
+func (e *FieldSelectorNotSupportedError) Error() string {
+	return fmt.Sprintf("%s don't support the field selector %q", e.Kind, e.FieldSelector)
 }
 
-func New[C Cmd](newCommandContext CommandContext[C]) *Kubectl[C] {
+// New returns a new Kubectl. The `globalFlags`, e.g. --context=foo, are passed
+// to every kubectl command.
+func New[C Cmd](newCommandContext CommandContext[C], globalFlags ...string) *Kubectl[C] {
 	return &Kubectl[C]{
 		commandContext: newCommandContext,
+		globalFlags:    globalFlags,
 	}
 }
 
-// ListApiResources returns a list of api resource names. If `namespaced` is
-// true, then only resources that live in namespaces are returned, otherwise
-// only resources that are global (non-namespaced) will be returned.
-// Note: whatever the value of `namespaced`, the events* resource is filtered
-// out from the results.
+// MetadataTemplate is the go-template given to kubectl get, unless getting
+// the whole objects, so that only the fields of Resource are written instead
+// of every object in full, e.g. the data of every secret. It writes the same
+// JSON as `kubectl get -o json`, with a status that only has the phase and
+// the Ready condition. The strings are quoted with printf since kubectl has
+// no JSON template function. Go quotes the names, timestamps and label values
+// the way JSON does, but not every string, e.g. a control character in the
+// free-text phase of a custom resource, the kind is then got with -o json.
+const MetadataTemplate = `{"items": [
+{{- range $i, $item := .items}}{{if $i}},{{end}}
+{"apiVersion": {{printf "%q" .apiVersion}}, "kind": {{printf "%q" .kind}}
+{{- with .metadata}}, "metadata": {"name": {{printf "%q" .name}}
+	{{- with .namespace}}, "namespace": {{printf "%q" .}}{{end}}
+	{{- with .uid}}, "uid": {{printf "%q" .}}{{end}}
+	{{- with .creationTimestamp}}, "creationTimestamp": {{printf "%q" .}}{{end}}
+	{{- with .deletionTimestamp}}, "deletionTimestamp": {{printf "%q" .}}{{end}}
+	{{- with .finalizers}}, "finalizers": [{{range $j, $finalizer := .}}{{if $j}},{{end}}{{printf "%q" $finalizer}}{{end}}]{{end}}
+	{{- with .labels}}, "labels": { {{- $first := true}}{{range $key, $value := .}}{{if not $first}},{{end}}{{$first = false}}{{printf "%q" $key}}: {{printf "%q" $value}}{{end}}}{{end}}
+	{{- with .ownerReferences}}, "ownerReferences": [{{range $j, $owner := .}}{{if $j}},{{end}}{"apiVersion": {{printf "%q" $owner.apiVersion}}, "kind": {{printf "%q" $owner.kind}}, "name": {{printf "%q" $owner.name}}, "uid": {{printf "%q" $owner.uid}}{{if $owner.controller}}, "controller": true{{end}}}{{end}}]{{end}}}
+{{- end}}
+{{- /* the status of some kinds isn't an object */}}
+{{- if eq (printf "%T" .status) "map[string]interface {}"}}{{with .status}}, "status": {"phase": {{with .phase}}{{printf "%q" (printf "%v" .)}}{{else}}""{{end}}
+	{{- if eq (printf "%T" .conditions) "[]interface {}"}}, "conditions": [{{$first := true}}{{range .conditions}}
+		{{- if eq (printf "%T" .) "map[string]interface {}"}}{{if eq (printf "%v" .type) "Ready"}}{{if not $first}},{{end}}{{$first = false}}{"type": "Ready", "status": {{printf "%q" (printf "%v" .status)}}}{{end}}{{end}}
+	{{- end}}]{{end}}}
+{{- end}}{{end}}}
+{{- end}}
+]}`
+
+// PartialDiscoveryError is returned by ListApiResources, along with the api
+// resources that could be discovered, when some API groups couldn't be
+// discovered.
+type PartialDiscoveryError struct {
+	// Message is what kubectl wrote to stderr
+	Message string
+}
+
+func (e *PartialDiscoveryError) Error() string {
+	return "partial discovery of API resources:\n" + e.Message
+}
+
+// failedGroupVersionRegex matches the start of the failure of each group
+// version in the message, e.g. `metrics.k8s.io/v1beta1: `
+var failedGroupVersionRegex = regexp.MustCompile(`(?:server APIs: |, )([a-z0-9][a-z0-9.-]*/v[a-z0-9]+): `)
+
+// FailedGroupVersions returns the reason why each API group version couldn't
+// be discovered, indexed by group version, e.g. metrics.k8s.io/v1beta1. These
+// are usually aggregated APIs whose backing service is unavailable.
+func (e *PartialDiscoveryError) FailedGroupVersions() map[string]string {
+	// only the last line has the complete list, e.g.
+	// error: unable to retrieve the complete list of server APIs: a/v1: reason, b/v1: reason
+	lines := strings.Split(strings.TrimSpace(e.Message), "\n")
+	line := lines[len(lines)-1]
+	failed := make(map[string]string)
+	matches := failedGroupVersionRegex.FindAllStringSubmatchIndex(line, -1)
+	for i, match := range matches {
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		failed[line[match[2]:match[3]]] = line[match[1]:end]
+	}
+	return failed
+}
+
+// ListApiResources returns the sorted list of api resource names. If
+// `namespaced` is true, then only resources that live in namespaces are
+// returned, otherwise only resources that are global (non-namespaced) will be
+// returned.
 func (k *Kubectl[C]) ListApiResources(ctx context.Context, namespaced bool) ([]string, error) {
+	server := k.serverURL(ctx)
+	if server != "" {
+		if apiResources, found := k.DiscoveryCache.Get(server, namespaced); found {
+			k.discoveryMu.Lock()
+			k.cachedDiscovery = true
+			k.discoveryMu.Unlock()
+			return apiResources, nil
+		}
+	}
+	return k.listApiResources(ctx, server, namespaced)
+}
+
+// listApiResources runs kubectl api-resources and caches the api resources of
+// the server, if any.
+func (k *Kubectl[C]) listApiResources(ctx context.Context, server string, namespaced bool) ([]string, error) {
 	// cmd := fmt.Sprintf("kubectl api-resources --verbs=list --namespaced=%t -o name", namespaced)
 	namespacedString := strconv.FormatBool(namespaced)
-	cmd := k.commandContext(ctx, "kubectl", "api-resources", "--verbs=list", "--namespaced="+string(namespacedString), "-o", "name")
+	cmd := k.commandContext(ctx, "kubectl", k.args("api-resources", "--verbs=list", "--namespaced="+string(namespacedString), "-o", "name")...)
 	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(bytes.TrimSpace(output)) > 0 {
+			// kubectl lists what it could discover before failing when some
+			// API groups are unavailable, e.g. a broken aggregated API
+			return splitLines(string(output), ""), &PartialDiscoveryError{
+				Message: strings.TrimSpace(string(exitErr.Stderr)),
+			}
+		}
+		return nil, err
+	}
+	apiResources := splitLines(string(output), "")
+	if server != "" {
+		// the cache is only an optimization, failing to write to it isn't
+		// worth failing the run
+		_ = k.DiscoveryCache.Set(server, namespaced, apiResources)
+	}
+	return apiResources, nil
+}
+
+// serverURL returns the URL of the API server of the cluster, which is the
+// key of the discovery cache. It's empty when there's no discovery cache or
+// when the URL can't be found, in which case the cache isn't used.
+func (k *Kubectl[C]) serverURL(ctx context.Context) string {
+	if k.DiscoveryCache == nil {
+		return ""
+	}
+	k.serverOnce.Do(func() {
+		output, err := k.run(ctx, "config", "view", "--minify", "-o", "jsonpath={.clusters[0].cluster.server}")
+		if err == nil {
+			k.server = strings.TrimSpace(string(output))
+		}
+	})
+	return k.server
+}
+
+// ListContexts returns the sorted names of the contexts of the kubeconfig.
+func (k *Kubectl[C]) ListContexts(ctx context.Context) ([]string, error) {
+	output, err := k.run(ctx, "config", "get-contexts", "-o", "name")
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(string(output), ""), nil
+}
+
+// ListNamespaces returns the sorted names of the namespaces of the cluster.
+func (k *Kubectl[C]) ListNamespaces(ctx context.Context) ([]string, error) {
+	output, err := k.run(ctx, "get", "namespaces", "-o", "name")
 	if err != nil {
 		return nil, err
 	}
-	resourceKinds := splitFilterAndSort(string(output))
-	sort.Strings(resourceKinds)
-	return resourceKinds, nil
+	return splitLines(string(output), "namespace/"), nil
 }
 
 // GetNamespacedResources returns the resouces in the given namespace.
-func (k *Kubectl[C]) GetNamespacedResources(ctx context.Context, namespace, kind string) ([]string, error) {
-	cmd := k.commandContext(ctx, "kubectl", "--namespace="+namespace, "get", "--show-kind", "--ignore-not-found", "-o", "name", kind)
-	output, err := cmd.Output()
+func (k *Kubectl[C]) GetNamespacedResources(ctx context.Context, namespace, kind string) ([]*Resource, error) {
+	return k.getResources(ctx, kind, "--namespace="+namespace, "get", "--ignore-not-found", "-o", k.output())
+}
+
+// GetAllNamespacesResources returns the resources of the given kind across
+// all namespaces.
+func (k *Kubectl[C]) GetAllNamespacesResources(ctx context.Context, kind string) ([]*Resource, error) {
+	return k.getResources(ctx, kind, "get", "--all-namespaces", "--ignore-not-found", "-o", k.output())
+}
+
+// GetResources returns the resources of the given kind in the current
+// namespace, or the non-namespaced resources if the kind isn't namespaced.
+func (k *Kubectl[C]) GetResources(ctx context.Context, kind string) ([]*Resource, error) {
+	return k.getResources(ctx, kind, "get", "--ignore-not-found", "-o", k.output())
+}
+
+// output returns the output format of kubectl get.
+func (k *Kubectl[C]) output() string {
+	if k.FullObjects {
+		return "json"
+	}
+	return "go-template=" + MetadataTemplate
+}
+
+// getResources runs kubectl with the given args followed by the selectors and
+// the kind.
+func (k *Kubectl[C]) getResources(ctx context.Context, kind string, args ...string) ([]*Resource, error) {
+	if k.LabelSelector != "" {
+		args = append(args, "--selector="+k.LabelSelector)
+	}
+	if k.FieldSelector != "" {
+		args = append(args, "--field-selector="+k.FieldSelector)
+	}
+	args = append(args, kind)
+	output, err := k.run(ctx, args...)
+	if err != nil && unknownResourceTypeRegex.MatchString(err.Error()) {
+		// the kind may come from stale cached api resources, e.g. a CRD
+		// that was removed since, or one removed and installed again
+		if apiResources, rediscovered := k.rediscover(ctx); rediscovered {
+			if !apiResources[kind] {
+				return nil, nil
+			}
+			output, err = k.run(ctx, args...)
+		}
+	}
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("could not run kubectl:\n%s", exitErr.Stderr)
+		if k.FieldSelector != "" && fieldSelectorNotSupportedRegex.MatchString(err.Error()) {
+			return nil, &FieldSelectorNotSupportedError{Kind: kind, FieldSelector: k.FieldSelector}
 		}
 		return nil, err
 	}
-	return splitFilterAndSort(string(output)), nil
+	resources, err := parseResourceList(output, kind, k.FullObjects)
+	if err != nil && !k.FullObjects {
+		// some strings weren't quoted the way JSON does by the template
+		if output, err = k.run(ctx, withJSONOutput(args)...); err != nil {
+			return nil, err
+		}
+		resources, err = parseResourceList(output, kind, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse kubectl output: %w", err)
+	}
+	return resources, nil
+}
+
+// withJSONOutput returns a copy of the args of kubectl get with the output
+// format replaced by json.
+func withJSONOutput(args []string) []string {
+	jsonArgs := make([]string, len(args))
+	copy(jsonArgs, args)
+	for i := range jsonArgs[:len(jsonArgs)-1] {
+		if jsonArgs[i] == "-o" {
+			jsonArgs[i+1] = "json"
+		}
+	}
+	return jsonArgs
 }
 
-// GetResources returns non-namespaced resources.
-func (k *Kubectl[C]) GetResources(ctx context.Context, kind string) ([]string, error) {
-	cmd := k.commandContext(ctx, "kubectl", "get", "--show-kind", "--ignore-not-found", "-o", "name", kind)
+// unknownResourceTypeRegex matches the error of kubectl get for a kind that
+// the server doesn't serve.
+var unknownResourceTypeRegex = regexp.MustCompile(`the server doesn't have a resource type`)
+
+// rediscover drops the cached api resources and discovers them again, only
+// once for all the kinds. It returns false when the api resources didn't
+// come from the cache or couldn't be discovered again completely.
+func (k *Kubectl[C]) rediscover(ctx context.Context) (map[string]bool, bool) {
+	k.discoveryMu.Lock()
+	defer k.discoveryMu.Unlock()
+	if !k.cachedDiscovery {
+		return nil, false
+	}
+	if k.rediscovered == nil && k.rediscoverErr == nil {
+		server := k.serverURL(ctx)
+		// the next runs don't use the stale api resources even if they can't
+		// be discovered again
+		_ = k.DiscoveryCache.Delete(server)
+		apiResources := make(map[string]bool)
+		for _, namespaced := range []bool{true, false} {
+			var names []string
+			if names, k.rediscoverErr = k.listApiResources(ctx, server, namespaced); k.rediscoverErr != nil {
+				break
+			}
+			for _, name := range names {
+				apiResources[name] = true
+			}
+		}
+		if k.rediscoverErr == nil {
+			k.rediscovered = apiResources
+		}
+	}
+	return k.rediscovered, k.rediscoverErr == nil
+}
+
+// run runs kubectl with the given args and returns its output. If kubectl
+// fails, the returned error contains what kubectl wrote to stderr.
+func (k *Kubectl[C]) run(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := k.commandContext(ctx, "kubectl", k.args(args...)...)
 	output, err := cmd.Output()
 	if err != nil {
 		var exitErr *exec.ExitError
@@ -72,22 +348,36 @@ func (k *Kubectl[C]) GetResources(ctx context.Context, kind string) ([]string, e
 		}
 		return nil, err
 	}
-	if len(output) == 0 {
-		return nil, nil
-	}
-	return splitFilterAndSort(string(output)), nil
+	return output, nil
 }
 
-var eventsRegex = regexp.MustCompile(`^events(\.events\.k8s.io)?$`)
+// args returns the given kubectl args prefixed by the global flags.
+func (k *Kubectl[C]) args(args ...string) []string {
+	if len(k.globalFlags) == 0 {
+		return args
+	}
+	return append(append([]string{}, k.globalFlags...), args...)
+}
 
-func splitFilterAndSort(output string) []string {
-	var filteredLines []string
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	for _, line := range lines {
-		if !eventsRegex.MatchString(line) {
-			filteredLines = append(filteredLines, line)
+// splitLines returns the sorted non-empty lines of the output, without the
+// given prefix.
+func splitLines(output, prefix string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			lines = append(lines, strings.TrimPrefix(line, prefix))
 		}
 	}
-	sort.Strings(filteredLines)
-	return filteredLines
+	sort.Strings(lines)
+	return lines
+}
+
+// fieldSelectorNotSupportedRegex matches the errors of the API server when a
+// field selector isn't supported by a kind
+var fieldSelectorNotSupportedRegex = regexp.MustCompile(`is not a known field selector|field label "[^"]*" not supported`)
+
+// IsFieldSelectorNotSupported returns true if the error message of the API
+// server means that a kind doesn't support the field selector.
+func IsFieldSelectorNotSupported(message string) bool {
+	return fieldSelectorNotSupportedRegex.MatchString(message)
 }
@@ -2,24 +2,35 @@ package kubectl_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"os/exec"
+	"strconv"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
 )
 
 type mockCmd struct {
-	calls  int
-	err    error
+	calls int
+	err   error
+	// errs are the errors of each call, if any, on top of err
+	errs   []error
 	output []string
 }
 
 func (m *mockCmd) Output() ([]byte, error) {
 	m.calls++
+	if m.calls <= len(m.errs) && m.errs[m.calls-1] != nil {
+		return nil, m.errs[m.calls-1]
+	}
 	if m.err != nil {
+		if m.calls <= len(m.output) {
+			return []byte(m.output[m.calls-1]), m.err
+		}
 		return nil, m.err
 	}
 	return []byte(m.output[m.calls-1]), nil
@@ -32,7 +43,7 @@ type fixture struct {
 	kubectl    *kubectl.Kubectl[*mockCmd]
 }
 
-func newFixture(cmd *mockCmd) *fixture {
+func newFixture(cmd *mockCmd, globalFlags ...string) *fixture {
 	f := &fixture{}
 	f.kubectl = kubectl.New(func(_ context.Context, name string, args ...string) *mockCmd {
 		f.actualName = name
@@ -41,10 +52,36 @@ func newFixture(cmd *mockCmd) *fixture {
 			cmd.output = []string{}
 		}
 		return cmd
-	})
+	}, globalFlags...)
 	return f
 }
 
+func TestKubectl_GlobalFlags(t *testing.T) {
+	t.Parallel()
+	globalFlags := []string{"--context=prod", "--kubeconfig=/tmp/config"}
+	t.Run("are passed to api-resources", func(t *testing.T) {
+		f := newFixture(&mockCmd{output: []string{"pods\n"}}, globalFlags...)
+		_, err := f.kubectl.ListApiResources(context.Background(), true)
+		assert.Nil(t, err)
+		expectedArgs := []string{"--context=prod", "--kubeconfig=/tmp/config", "api-resources", "--verbs=list", "--namespaced=true", "-o", "name"}
+		assert.SliceEquals(t, expectedArgs, f.actualArgs)
+	})
+
+	t.Run("are passed to get", func(t *testing.T) {
+		f := newFixture(&mockCmd{output: []string{podList, podList, podList}}, globalFlags...)
+		f.kubectl.FullObjects = true
+		_, err := f.kubectl.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"--context=prod", "--kubeconfig=/tmp/config", "get", "--ignore-not-found", "-o", "json", "pods"}, f.actualArgs)
+		_, err = f.kubectl.GetNamespacedResources(context.Background(), "ns", "pods")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"--context=prod", "--kubeconfig=/tmp/config", "--namespace=ns", "get", "--ignore-not-found", "-o", "json", "pods"}, f.actualArgs)
+		_, err = f.kubectl.GetAllNamespacesResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"--context=prod", "--kubeconfig=/tmp/config", "get", "--all-namespaces", "--ignore-not-found", "-o", "json", "pods"}, f.actualArgs)
+	})
+}
+
 func TestKubectl_GetApiResources(t *testing.T) {
 	t.Parallel()
 	t.Run("returns the list of namespaced api resources", func(t *testing.T) {
@@ -64,7 +101,7 @@ func TestKubectl_GetApiResources(t *testing.T) {
 		}
 	})
 
-	t.Run("filters out events from api resources", func(t *testing.T) {
+	t.Run("returns every api resource, including events", func(t *testing.T) {
 		cmd := &mockCmd{
 			output: []string{"services\nevents\nevents.events.k8s.io\ndeployment\n"},
 		}
@@ -73,12 +110,27 @@ func TestKubectl_GetApiResources(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		expectedLines := []string{"deployment", "services"}
+		expectedLines := []string{"deployment", "events", "events.events.k8s.io", "services"}
 		if strings.Join(expectedLines, "\n") != strings.Join(resources, "\n") {
 			t.Fatalf("expected:\n%s, actual:\n%s", expectedLines, resources)
 		}
 	})
 
+	t.Run("returns the api resources it could discover when some API groups are unavailable", func(t *testing.T) {
+		cmd := &mockCmd{
+			output: []string{"services\npods\n"},
+			err: &exec.ExitError{
+				Stderr: []byte("error: unable to retrieve the complete list of server APIs: metrics.k8s.io/v1beta1: the server is currently unable to handle the request\n"),
+			},
+		}
+		f := newFixture(cmd)
+		resources, err := f.kubectl.ListApiResources(context.Background(), true)
+		assert.SliceEquals(t, []string{"pods", "services"}, resources)
+		var partialErr *kubectl.PartialDiscoveryError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Contains(t, partialErr.Message, "metrics.k8s.io/v1beta1")
+	})
+
 	t.Run("returns an error if exec returns an error", func(t *testing.T) {
 		cmd := &mockCmd{err: errors.New("this is an error")}
 		f := newFixture(cmd)
@@ -88,31 +140,250 @@ func TestKubectl_GetApiResources(t *testing.T) {
 	})
 }
 
+const podList = `{
+	"apiVersion": "v1",
+	"kind": "List",
+	"items": [
+		{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo", "namespace": "b"}},
+		{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "bar", "namespace": "b"}},
+		{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "baz", "namespace": "a"}}
+	]
+}`
+
+func resourceNames(resources []*kubectl.Resource) []string {
+	var names []string
+	for _, resource := range resources {
+		names = append(names, resource.Namespace()+"/"+resource.String())
+	}
+	return names
+}
+
+func TestKubectl_ListContexts(t *testing.T) {
+	cmd := &mockCmd{output: []string{"prod\ndev\n"}}
+	f := newFixture(cmd)
+	contexts, err := f.kubectl.ListContexts(context.Background())
+	assert.Nil(t, err)
+	assert.SliceEquals(t, []string{"dev", "prod"}, contexts)
+	assert.SliceEquals(t, []string{"config", "get-contexts", "-o", "name"}, f.actualArgs)
+}
+
+func TestKubectl_ListNamespaces(t *testing.T) {
+	t.Parallel()
+	t.Run("works", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{"namespace/kube-system\nnamespace/default\n"}}
+		f := newFixture(cmd)
+		namespaces, err := f.kubectl.ListNamespaces(context.Background())
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"default", "kube-system"}, namespaces)
+		assert.SliceEquals(t, []string{"get", "namespaces", "-o", "name"}, f.actualArgs)
+	})
+
+	t.Run("returns stderr when there's an error", func(t *testing.T) {
+		cmd := &mockCmd{err: &exec.ExitError{Stderr: []byte("forbidden")}}
+		f := newFixture(cmd)
+		_, err := f.kubectl.ListNamespaces(context.Background())
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "forbidden")
+	})
+}
+
 func TestKubectl_GetNamespacedResource(t *testing.T) {
-	cmd := &mockCmd{output: []string{"resourceB\nresourceA\n"}}
+	cmd := &mockCmd{output: []string{podList}}
 	f := newFixture(cmd)
 	actualResources, err := f.kubectl.GetNamespacedResources(context.Background(), "<ns>", "<res>")
 	assert.Nil(t, err)
-	assert.SliceEquals(t, []string{"resourceA", "resourceB"}, actualResources)
+	assert.SliceEquals(t, []string{"a/pod/baz", "b/pod/bar", "b/pod/foo"}, resourceNames(actualResources))
 	assert.Equals(t, "kubectl", f.actualName)
-	expectedArgs := []string{"--namespace=<ns>", "get", "--show-kind", "--ignore-not-found", "-o", "name", "<res>"}
+	expectedArgs := []string{"--namespace=<ns>", "get", "--ignore-not-found", "-o", "go-template=" + kubectl.MetadataTemplate, "<res>"}
+	assert.SliceEquals(t, expectedArgs, f.actualArgs)
+}
+
+func TestKubectl_Selectors(t *testing.T) {
+	t.Parallel()
+	t.Run("are passed to get", func(t *testing.T) {
+		f := newFixture(&mockCmd{output: []string{podList}})
+		f.kubectl.LabelSelector = "app=payments"
+		f.kubectl.FieldSelector = "status.phase=Running"
+		_, err := f.kubectl.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		expectedArgs := []string{"get", "--ignore-not-found", "-o", "go-template=" + kubectl.MetadataTemplate, "--selector=app=payments", "--field-selector=status.phase=Running", "pods"}
+		assert.SliceEquals(t, expectedArgs, f.actualArgs)
+	})
+
+	t.Run("returns a specific error when a kind doesn't support the field selector", func(t *testing.T) {
+		cmd := &mockCmd{err: &exec.ExitError{Stderr: []byte(`Error from server (BadRequest): Unable to find "/v1, Resource=configmaps" that match label selector "", field selector "status.phase=Running": "status.phase" is not a known field selector: only "metadata.name", "metadata.namespace"`)}}
+		f := newFixture(cmd)
+		f.kubectl.FieldSelector = "status.phase=Running"
+		_, err := f.kubectl.GetAllNamespacesResources(context.Background(), "configmaps")
+		var notSupportedErr *kubectl.FieldSelectorNotSupportedError
+		assert.True(t, errors.As(err, &notSupportedErr))
+		assert.Equals(t, "configmaps", notSupportedErr.Kind)
+	})
+}
+
+type mockDiscoveryCache struct {
+	apiResources map[string][]string
+	deleted      []string
+}
+
+func (m *mockDiscoveryCache) key(server string, namespaced bool) string {
+	return server + "/" + strconv.FormatBool(namespaced)
+}
+
+func (m *mockDiscoveryCache) Get(server string, namespaced bool) ([]string, bool) {
+	apiResources, found := m.apiResources[m.key(server, namespaced)]
+	return apiResources, found
+}
+
+func (m *mockDiscoveryCache) Set(server string, namespaced bool, apiResources []string) error {
+	m.apiResources[m.key(server, namespaced)] = apiResources
+	return nil
+}
+
+func (m *mockDiscoveryCache) Delete(server string) error {
+	m.deleted = append(m.deleted, server)
+	delete(m.apiResources, m.key(server, true))
+	delete(m.apiResources, m.key(server, false))
+	return nil
+}
+
+func TestKubectl_DiscoveryCache(t *testing.T) {
+	t.Parallel()
+	t.Run("caches the api resources by server", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{"https://a.example.com\n", "services\npods\n"}}
+		f := newFixture(cmd, "--context=prod")
+		cache := &mockDiscoveryCache{apiResources: map[string][]string{}}
+		f.kubectl.DiscoveryCache = cache
+		apiResources, err := f.kubectl.ListApiResources(context.Background(), true)
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"pods", "services"}, apiResources)
+		assert.SliceEquals(t, []string{"pods", "services"}, cache.apiResources["https://a.example.com/true"])
+		assert.Equals(t, 2, cmd.calls)
+	})
+
+	t.Run("uses the cached api resources instead of running api-resources", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{"https://a.example.com\n"}}
+		f := newFixture(cmd, "--context=prod")
+		f.kubectl.DiscoveryCache = &mockDiscoveryCache{apiResources: map[string][]string{
+			"https://a.example.com/false": {"nodes"},
+		}}
+		apiResources, err := f.kubectl.ListApiResources(context.Background(), false)
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"nodes"}, apiResources)
+		assert.Equals(t, 1, cmd.calls)
+		expectedArgs := []string{"--context=prod", "config", "view", "--minify", "-o", "jsonpath={.clusters[0].cluster.server}"}
+		assert.SliceEquals(t, expectedArgs, f.actualArgs)
+	})
+}
+
+func TestKubectl_StaleDiscoveryCache(t *testing.T) {
+	t.Parallel()
+	unknownKind := errors.New(`error: the server doesn't have a resource type "widgets"`)
+	newCachedFixture := func(cmd *mockCmd) (*fixture, *mockDiscoveryCache) {
+		f := newFixture(cmd)
+		cache := &mockDiscoveryCache{apiResources: map[string][]string{
+			"https://a.example.com/true":  {"pods", "widgets.example.com"},
+			"https://a.example.com/false": {"nodes"},
+		}}
+		f.kubectl.DiscoveryCache = cache
+		_, err := f.kubectl.ListApiResources(context.Background(), true)
+		assert.Nil(t, err)
+		return f, cache
+	}
+
+	t.Run("skips the cached kinds that were removed", func(t *testing.T) {
+		cmd := &mockCmd{
+			output: []string{"https://a.example.com\n", "", "pods\n", "nodes\n", ""},
+			errs:   []error{nil, unknownKind, nil, nil, unknownKind},
+		}
+		f, cache := newCachedFixture(cmd)
+		resources, err := f.kubectl.GetAllNamespacesResources(context.Background(), "widgets.example.com")
+		assert.Nil(t, err)
+		assert.Equals(t, 0, len(resources))
+		assert.SliceEquals(t, []string{"https://a.example.com"}, cache.deleted)
+		assert.SliceEquals(t, []string{"pods"}, cache.apiResources["https://a.example.com/true"])
+		assert.Equals(t, 4, cmd.calls)
+
+		// the api resources are only discovered again once
+		resources, err = f.kubectl.GetAllNamespacesResources(context.Background(), "widgets.example.com")
+		assert.Nil(t, err)
+		assert.Equals(t, 0, len(resources))
+		assert.Equals(t, 5, cmd.calls)
+	})
+
+	t.Run("gets the resources again when the kind is still served", func(t *testing.T) {
+		cmd := &mockCmd{
+			output: []string{"https://a.example.com\n", "", "pods\nwidgets.example.com\n", "nodes\n", podList},
+			errs:   []error{nil, unknownKind},
+		}
+		f, _ := newCachedFixture(cmd)
+		resources, err := f.kubectl.GetAllNamespacesResources(context.Background(), "widgets.example.com")
+		assert.Nil(t, err)
+		assert.Equals(t, 3, len(resources))
+		assert.Equals(t, 5, cmd.calls)
+	})
+
+	t.Run("returns the error when the api resources weren't cached", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{""}, errs: []error{unknownKind}}
+		f := newFixture(cmd)
+		_, err := f.kubectl.GetAllNamespacesResources(context.Background(), "widgets.example.com")
+		assert.NotNil(t, err)
+		assert.Equals(t, 1, cmd.calls)
+	})
+}
+
+func TestKubectl_GetAllNamespacesResources(t *testing.T) {
+	cmd := &mockCmd{output: []string{podList}}
+	f := newFixture(cmd)
+	actualResources, err := f.kubectl.GetAllNamespacesResources(context.Background(), "pods")
+	assert.Nil(t, err)
+	assert.SliceEquals(t, []string{"a/pod/baz", "b/pod/bar", "b/pod/foo"}, resourceNames(actualResources))
+	assert.Equals(t, "pods", actualResources[0].Resource)
+	assert.Equals(t, "", actualResources[0].Group())
+	assert.Equals(t, "v1", actualResources[0].Version())
+	expectedArgs := []string{"get", "--all-namespaces", "--ignore-not-found", "-o", "go-template=" + kubectl.MetadataTemplate, "pods"}
 	assert.SliceEquals(t, expectedArgs, f.actualArgs)
 }
 
 func TestKubectl_GetResources(t *testing.T) {
 	t.Parallel()
 	t.Run("works", func(t *testing.T) {
-		cmd := &mockCmd{output: []string{"foo\nbar\nbaz\n"}}
+		cmd := &mockCmd{output: []string{`{"items": [
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "foo"}},
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "bar"}}
+		]}`}}
 		f := newFixture(cmd)
 		actualResources, err := f.kubectl.GetResources(context.Background(), "deployment")
 		assert.Nil(t, err)
-		assert.SliceEquals(t, []string{"bar", "baz", "foo"}, actualResources)
-		expectedArgs := []string{"get", "--show-kind", "--ignore-not-found", "-o", "name", "deployment"}
+		assert.SliceEquals(t, []string{"/deployment.apps/bar", "/deployment.apps/foo"}, resourceNames(actualResources))
+		assert.Equals(t, "deployment", actualResources[0].Resource)
+		assert.Equals(t, "apps", actualResources[0].Group())
+		assert.Equals(t, "v1", actualResources[0].Version())
+		expectedArgs := []string{"get", "--ignore-not-found", "-o", "go-template=" + kubectl.MetadataTemplate, "deployment"}
 		assert.Equals(t, "kubectl", f.actualName)
 		assert.SliceEquals(t, expectedArgs, f.actualArgs)
 
 	})
 
+	t.Run("gets the whole objects", func(t *testing.T) {
+		secret := `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "token"}, "data": {"token": "c2VjcmV0"}}`
+		cmd := &mockCmd{output: []string{`{"items": [` + secret + `]}`}}
+		f := newFixture(cmd)
+		f.kubectl.FullObjects = true
+		resources, err := f.kubectl.GetResources(context.Background(), "secrets")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"get", "--ignore-not-found", "-o", "json", "secrets"}, f.actualArgs)
+		assert.Equals(t, secret, string(resources[0].Raw))
+	})
+
+	t.Run("returns nothing when no resources are found", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{`{"apiVersion": "v1", "items": [], "kind": "List"}`}}
+		f := newFixture(cmd)
+		actualResources, err := f.kubectl.GetResources(context.Background(), "deployment")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, nil, actualResources)
+	})
+
 	t.Run("returns stderr when there's an error", func(t *testing.T) {
 		cmd := &mockCmd{output: []string{"foo\nbar\nbaz\n"}}
 		cmd.err = &exec.ExitError{Stderr: []byte("some error")}
@@ -121,4 +392,121 @@ func TestKubectl_GetResources(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "some error")
 	})
+
+	t.Run("gets the kind as JSON when the template output isn't valid JSON", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{
+			`{"items": [{"apiVersion": "example.com/v1", "kind": "Job", "metadata": {"name": "foo"}, "status": {"phase": "\x1b[31mFailed"}}]}`,
+			`{"items": [{"apiVersion": "example.com/v1", "kind": "Job", "metadata": {"name": "foo"}, "status": {"phase": "\u001b[31mFailed"}}]}`,
+		}}
+		f := newFixture(cmd)
+		resources, err := f.kubectl.GetResources(context.Background(), "jobs.example.com")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"get", "--ignore-not-found", "-o", "json", "jobs.example.com"}, f.actualArgs)
+		assert.SliceEquals(t, []string{"/job.example.com/foo"}, resourceNames(resources))
+		assert.Equals(t, "\x1b[31mFailed", resources[0].Status())
+	})
+
+	t.Run("returns an error when the output can't be parsed", func(t *testing.T) {
+		cmd := &mockCmd{output: []string{"deployment.apps/foo\n", "deployment.apps/foo\n"}}
+		f := newFixture(cmd)
+		_, err := f.kubectl.GetResources(context.Background(), "deploy")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "could not parse kubectl output")
+	})
+}
+
+func TestMetadataTemplate(t *testing.T) {
+	t.Parallel()
+	// the template is executed by kubectl over the decoded list
+	execute := func(t *testing.T, list string) string {
+		t.Helper()
+		var data any
+		assert.Nil(t, json.Unmarshal([]byte(list), &data))
+		tmpl, err := template.New("output").Parse(kubectl.MetadataTemplate)
+		assert.Nil(t, err)
+		var output strings.Builder
+		assert.Nil(t, tmpl.Execute(&output, data))
+		return output.String()
+	}
+
+	t.Run("only writes the fields of Resource", func(t *testing.T) {
+		output := execute(t, `{"apiVersion": "v1", "kind": "List", "items": [
+			{
+				"apiVersion": "v1",
+				"kind": "Pod",
+				"metadata": {
+					"name": "web-0",
+					"namespace": "default",
+					"uid": "1234",
+					"creationTimestamp": "2022-06-15T12:00:00Z",
+					"deletionTimestamp": "2022-06-16T12:00:00Z",
+					"finalizers": ["example.com/a", "example.com/b"],
+					"labels": {"app": "web", "tier": "front"},
+					"annotations": {"big": "annotation"},
+					"ownerReferences": [
+						{"apiVersion": "apps/v1", "kind": "StatefulSet", "name": "web", "uid": "5678", "controller": true},
+						{"apiVersion": "v1", "kind": "ConfigMap", "name": "owner", "uid": "9012"}
+					]
+				},
+				"spec": {"containers": []},
+				"status": {"phase": "Running", "conditions": [
+					{"type": "Initialized", "status": "True"},
+					{"type": "Ready", "status": "False"}
+				]}
+			},
+			{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "token", "namespace": "default"}, "data": {"token": "c2VjcmV0"}},
+			{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "a"}, "status": "not an object"}
+		]}`)
+
+		var decoded struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		assert.Nil(t, json.Unmarshal([]byte(output), &decoded))
+		assert.Equals(t, 3, len(decoded.Items))
+		assert.True(t, !strings.Contains(output, "annotation"))
+		assert.True(t, !strings.Contains(output, "c2VjcmV0"))
+		assert.True(t, !strings.Contains(output, "containers"))
+		assert.True(t, !strings.Contains(output, "Initialized"))
+
+		f := newFixture(&mockCmd{output: []string{output}})
+		resources, err := f.kubectl.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		// the cluster-scoped widget is first
+		pod := resources[1]
+		assert.Equals(t, "default/pod/web-0", pod.Namespace()+"/"+pod.String())
+		assert.Equals(t, "1234", pod.Metadata.UID)
+		assert.Equals(t, 2022, pod.Metadata.CreationTimestamp.Year())
+		assert.Equals(t, 16, pod.Metadata.DeletionTimestamp.Day())
+		assert.SliceEquals(t, []string{"example.com/a", "example.com/b"}, pod.Metadata.Finalizers)
+		assert.Equals(t, "front", pod.Metadata.Labels["tier"])
+		assert.Equals(t, 2, len(pod.Metadata.OwnerReferences))
+		assert.True(t, *pod.Metadata.OwnerReferences[0].Controller)
+		assert.True(t, pod.Metadata.OwnerReferences[1].Controller == nil)
+		assert.Equals(t, "Terminating", pod.Status())
+		pod.Metadata.DeletionTimestamp = nil
+		assert.Equals(t, "Running", pod.Status())
+	})
+
+	t.Run("writes an empty list", func(t *testing.T) {
+		output := execute(t, `{"apiVersion": "v1", "kind": "List", "items": []}`)
+
+		f := newFixture(&mockCmd{output: []string{output}})
+		resources, err := f.kubectl.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		assert.Equals(t, 0, len(resources))
+	})
+}
+
+func TestPartialDiscoveryError_FailedGroupVersions(t *testing.T) {
+	t.Parallel()
+	err := &kubectl.PartialDiscoveryError{
+		Message: `E0615 12:00:00.000000   12345 memcache.go:255] couldn't get resource list for metrics.k8s.io/v1beta1: the server is currently unable to handle the request
+error: unable to retrieve the complete list of server APIs: custom.metrics.k8s.io/v1beta2: the server is currently unable to handle the request, metrics.k8s.io/v1beta1: Get "https://10.0.0.1:443/apis/metrics.k8s.io/v1beta1": dial tcp 10.0.0.1:443: i/o timeout`,
+	}
+
+	failed := err.FailedGroupVersions()
+
+	assert.Equals(t, 2, len(failed))
+	assert.Equals(t, "the server is currently unable to handle the request", failed["custom.metrics.k8s.io/v1beta2"])
+	assert.Equals(t, `Get "https://10.0.0.1:443/apis/metrics.k8s.io/v1beta1": dial tcp 10.0.0.1:443: i/o timeout`, failed["metrics.k8s.io/v1beta1"])
 }
@@ -0,0 +1,184 @@
+package kubectl
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Resource is a kubernetes object as returned by `kubectl get`.
+type Resource struct {
+	// Cluster is the kubeconfig context the resource was fetched from, it's
+	// only set when fetching from many contexts.
+	Cluster string `json:"-"`
+	// Resource is the plural name of the API resource the resource was
+	// listed as, e.g. deployments
+	Resource   string     `json:"-"`
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	// RawStatus is kept raw since its schema depends on the kind
+	RawStatus json.RawMessage `json:"status,omitempty"`
+	// Raw is the whole object as returned by the API server, it's only kept
+	// when getting the whole objects
+	Raw json.RawMessage `json:"-"`
+}
+
+// DecodeResource decodes the JSON object of a resource. The whole object is
+// kept in Raw when `keepRaw` is true, otherwise only the fields of Resource
+// are kept in memory, e.g. not the data of the secrets.
+func DecodeResource(data []byte, keepRaw bool) (*Resource, error) {
+	resource := &Resource{}
+	if err := json.Unmarshal(data, resource); err != nil {
+		return nil, err
+	}
+	if keepRaw {
+		resource.Raw = append(json.RawMessage{}, data...)
+	}
+	return resource, nil
+}
+
+// ObjectMeta is the subset of the kubernetes object metadata that we care
+// about.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
+	Finalizers        []string          `json:"finalizers,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference identifies the owner of a resource.
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Controller *bool  `json:"controller,omitempty"`
+}
+
+// resourceList is the list returned by `kubectl get -o json`.
+type resourceList struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// Group returns the API group of the resource, which is empty for the core
+// group.
+func (r *Resource) Group() string {
+	group, _, found := strings.Cut(r.APIVersion, "/")
+	if !found {
+		return ""
+	}
+	return group
+}
+
+// Version returns the API version of the resource, without the group.
+func (r *Resource) Version() string {
+	_, version, found := strings.Cut(r.APIVersion, "/")
+	if !found {
+		return r.APIVersion
+	}
+	return version
+}
+
+// Name returns the name of the resource.
+func (r *Resource) Name() string {
+	return r.Metadata.Name
+}
+
+// Namespace returns the namespace of the resource, which is empty for
+// cluster-scoped resources.
+func (r *Resource) Namespace() string {
+	return r.Metadata.Namespace
+}
+
+// Status returns a short description of the state of the resource:
+// Terminating when it's being deleted, otherwise its phase, e.g. Running, or
+// the status of its Ready condition. It's empty when the kind has no such
+// status.
+func (r *Resource) Status() string {
+	if r.Metadata.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	var status struct {
+		Phase      string `json:"phase"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	}
+	// the status of some kinds isn't an object, which means there's no status
+	// to report
+	if err := json.Unmarshal(r.RawStatus, &status); err != nil {
+		return ""
+	}
+	if status.Phase != "" {
+		return status.Phase
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == "Ready" {
+			if condition.Status == "True" {
+				return "Ready"
+			}
+			return "NotReady"
+		}
+	}
+	return ""
+}
+
+// String returns the resource in the same format as `kubectl get -o name`,
+// e.g. deployment.apps/foo
+func (r *Resource) String() string {
+	kind := strings.ToLower(r.Kind)
+	if group := r.Group(); group != "" {
+		kind += "." + group
+	}
+	return kind + "/" + r.Name()
+}
+
+// parseResourceList parses the output of `kubectl get -o json` for the given
+// kind, e.g. deployments.apps, keeping the whole objects when `keepRaw` is
+// true.
+func parseResourceList(output []byte, kind string, keepRaw bool) ([]*Resource, error) {
+	if len(output) == 0 {
+		return nil, nil
+	}
+	var list resourceList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	resources := make([]*Resource, 0, len(list.Items))
+	resourceName, _, _ := strings.Cut(kind, ".")
+	for _, item := range list.Items {
+		resource, err := DecodeResource(item, keepRaw)
+		if err != nil {
+			return nil, err
+		}
+		resource.Resource = resourceName
+		resources = append(resources, resource)
+	}
+	SortResources(resources)
+	return resources, nil
+}
+
+// SortResources sorts resources by cluster, namespace and then by the
+// `kubectl get -o name` representation of the resources.
+func SortResources(resources []*Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace() != b.Namespace() {
+			return a.Namespace() < b.Namespace()
+		}
+		return a.String() < b.String()
+	})
+}
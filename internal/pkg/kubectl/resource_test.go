@@ -0,0 +1,61 @@
+package kubectl_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func TestResource_Status(t *testing.T) {
+	testCases := []struct {
+		resource string
+		expected string
+	}{
+		{`{"metadata": {"name": "a"}, "status": {"phase": "Running"}}`, "Running"},
+		{`{"metadata": {"name": "a"}, "status": {"conditions": [{"type": "Available", "status": "True"}, {"type": "Ready", "status": "False"}]}}`, "NotReady"},
+		{`{"metadata": {"name": "a"}, "status": {"conditions": [{"type": "Ready", "status": "True"}]}}`, "Ready"},
+		{`{"metadata": {"name": "a", "deletionTimestamp": "2022-06-15T12:00:00Z"}, "status": {"phase": "Running"}}`, "Terminating"},
+		{`{"metadata": {"name": "a"}, "status": "not an object"}`, ""},
+		{`{"metadata": {"name": "a"}}`, ""},
+	}
+	for i, tc := range testCases {
+		var resource kubectl.Resource
+		assert.Nil(t, json.Unmarshal([]byte(tc.resource), &resource))
+		if actual := resource.Status(); actual != tc.expected {
+			t.Fatalf("test case #%d: expected %q, actual %q", i+1, tc.expected, actual)
+		}
+	}
+}
+
+func TestResource_Metadata(t *testing.T) {
+	var resource kubectl.Resource
+	err := json.Unmarshal([]byte(`{
+		"apiVersion": "v1",
+		"kind": "Pod",
+		"metadata": {
+			"name": "web-5d8f7c-x2x4z",
+			"creationTimestamp": "2022-06-15T12:00:00Z",
+			"labels": {"app": "web"},
+			"ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web-5d8f7c", "uid": "1234", "controller": true}]
+		}
+	}`), &resource)
+	assert.Nil(t, err)
+	assert.Equals(t, 2022, resource.Metadata.CreationTimestamp.Year())
+	assert.Equals(t, "web", resource.Metadata.Labels["app"])
+	assert.Equals(t, "ReplicaSet", resource.Metadata.OwnerReferences[0].Kind)
+	assert.True(t, *resource.Metadata.OwnerReferences[0].Controller)
+}
+
+func TestDecodeResource(t *testing.T) {
+	data := []byte(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "foo"}, "data": {"key": "value"}}`)
+	resource, err := kubectl.DecodeResource(data, true)
+	assert.Nil(t, err)
+	assert.Equals(t, "foo", resource.Name())
+	assert.Equals(t, string(data), string(resource.Raw))
+	resource, err = kubectl.DecodeResource(data, false)
+	assert.Nil(t, err)
+	assert.Equals(t, "foo", resource.Name())
+	assert.Equals(t, 0, len(resource.Raw))
+}
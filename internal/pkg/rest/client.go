@@ -0,0 +1,648 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+)
+
+// pageSize is the number of resources to get per request when listing.
+const pageSize = 500
+
+// metadataAccept is the Accept header to only list the metadata of the
+// objects, the API server returns the whole objects when it doesn't support
+// it.
+const metadataAccept = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json"
+
+// Client lists the resources of a cluster with the API server, it's a
+// drop-in replacement for kubectl.Kubectl that doesn't start a kubectl
+// process for every kind.
+type Client struct {
+	kubeconfig *Kubeconfig
+	overrides  Overrides
+	// LabelSelector filters the listed resources, e.g. app=payments
+	LabelSelector string
+	// FieldSelector filters the listed resources, e.g. status.phase=Running
+	FieldSelector string
+	// FullObjects makes the client list the whole objects, by default only
+	// their metadata is listed, which has no status
+	FullObjects bool
+
+	setupOnce  sync.Once
+	setupErr   error
+	config     *restConfig
+	httpClient *http.Client
+	// authorization is the value of the Authorization header, if any, when
+	// the user doesn't have a credential plugin
+	authorization string
+
+	// credentialMu guards the credential of the credential plugin, which is
+	// refreshed when it expires or when the API server rejects it
+	credentialMu sync.Mutex
+	credential   *credential
+
+	discoveryOnce sync.Once
+	discoveryErr  error
+	apiResources  map[string]*apiResource
+}
+
+// New returns a Client for the cluster of the kubeconfig selected by the
+// overrides. The kubeconfig is only resolved on the first request.
+func New(kubeconfig *Kubeconfig, overrides Overrides) *Client {
+	return &Client{
+		kubeconfig: kubeconfig,
+		overrides:  overrides,
+	}
+}
+
+// apiResource is a kind served by the API server.
+type apiResource struct {
+	// name is the name listed by `kubectl api-resources -o name`, e.g.
+	// deployments.apps
+	name         string
+	resource     string
+	groupVersion string
+	kind         string
+	namespaced   bool
+}
+
+// path returns the path to list the resources of the kind, in the given
+// namespace or across all namespaces when it's empty.
+func (a *apiResource) path(namespace string) string {
+	prefix := "/apis/" + a.groupVersion
+	if !strings.Contains(a.groupVersion, "/") {
+		prefix = "/api/" + a.groupVersion
+	}
+	if namespace != "" && a.namespaced {
+		return path.Join(prefix, "namespaces", namespace, a.resource)
+	}
+	return path.Join(prefix, a.resource)
+}
+
+// StatusError is returned when the API server responds with an error.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Code, http.StatusText(e.Code))
+}
+
+// setup resolves the kubeconfig and creates the HTTP client.
+func (c *Client) setup(ctx context.Context) error {
+	c.setupOnce.Do(func() {
+		c.setupErr = c.doSetup(ctx)
+	})
+	return c.setupErr
+}
+
+func (c *Client) doSetup(ctx context.Context) error {
+	config, err := c.kubeconfig.resolve(c.overrides)
+	if err != nil {
+		return err
+	}
+	c.config = config
+	cluster, user := config.cluster, config.user
+	if user.AuthProvider != nil {
+		return fmt.Errorf("the %q auth provider isn't supported, use the kubectl backend", user.AuthProvider.Name)
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cluster.InsecureSkipTLSVerify,
+		ServerName:         cluster.TLSServerName,
+	}
+	caData := cluster.CertificateAuthorityData
+	if len(caData) == 0 && cluster.CertificateAuthority != "" {
+		if caData, err = os.ReadFile(cluster.CertificateAuthority); err != nil {
+			return fmt.Errorf("could not read certificate authority: %w", err)
+		}
+	}
+	if len(caData) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caData) {
+			return errors.New("could not parse the certificate authority of the cluster")
+		}
+	}
+	certData, keyData := user.ClientCertificateData, user.ClientKeyData
+	if len(certData) == 0 && user.ClientCertificate != "" {
+		if certData, err = os.ReadFile(user.ClientCertificate); err != nil {
+			return fmt.Errorf("could not read client certificate: %w", err)
+		}
+	}
+	if len(keyData) == 0 && user.ClientKey != "" {
+		if keyData, err = os.ReadFile(user.ClientKey); err != nil {
+			return fmt.Errorf("could not read client key: %w", err)
+		}
+	}
+	token := user.Token
+	if token == "" && user.TokenFile != "" {
+		tokenData, err := os.ReadFile(user.TokenFile)
+		if err != nil {
+			return fmt.Errorf("could not read token file: %w", err)
+		}
+		token = strings.TrimSpace(string(tokenData))
+	}
+	if len(certData) > 0 {
+		certificate, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	switch {
+	case token != "":
+		c.authorization = "Bearer " + token
+	case user.Username != "":
+		c.authorization = "Basic " + basicAuth(user.Username, user.Password)
+	}
+	if user.Exec != nil {
+		if _, err := c.execCredential(ctx, nil); err != nil {
+			return err
+		}
+		certificates := tlsConfig.Certificates
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.credentialMu.Lock()
+			defer c.credentialMu.Unlock()
+			if c.credential != nil && c.credential.certificate != nil {
+				return c.credential.certificate, nil
+			}
+			if len(certificates) > 0 {
+				return &certificates[0], nil
+			}
+			return &tls.Certificate{}, nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	// the resources of many kinds are listed in parallel
+	transport.MaxIdleConnsPerHost = 100
+	if cluster.ProxyURL != "" {
+		proxyURL, err := url.Parse(cluster.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("could not parse proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	timeout, err := parseRequestTimeout(c.overrides.RequestTimeout)
+	if err != nil {
+		return err
+	}
+	c.httpClient = &http.Client{Transport: transport, Timeout: timeout}
+	return nil
+}
+
+// parseRequestTimeout parses the --request-timeout flag like kubectl: a
+// duration, e.g. 1m, or a number of seconds. Zero means no timeout.
+func parseRequestTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request timeout %q, it must be a duration, e.g. 1s, 2m", value)
+	}
+	return timeout, nil
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+// execCredential is what credential plugins write to stdout.
+type execCredential struct {
+	Status struct {
+		ExpirationTimestamp   *time.Time `json:"expirationTimestamp"`
+		Token                 string     `json:"token"`
+		ClientCertificateData string     `json:"clientCertificateData"`
+		ClientKeyData         string     `json:"clientKeyData"`
+	} `json:"status"`
+}
+
+// credential is the credential returned by the credential plugin.
+type credential struct {
+	// authorization is the value of the Authorization header, if any
+	authorization string
+	certificate   *tls.Certificate
+	// expiry is when the credential expires, zero if it doesn't
+	expiry time.Time
+}
+
+// execCredential returns the credential of the credential plugin, running the
+// plugin when there's no credential yet, when it expired or when it's the
+// credential rejected by the API server, if any. When many requests are
+// rejected with the same credential, the plugin only runs once.
+func (c *Client) execCredential(ctx context.Context, rejected *credential) (*credential, error) {
+	c.credentialMu.Lock()
+	defer c.credentialMu.Unlock()
+	current := c.credential
+	if current != nil && current != rejected && (current.expiry.IsZero() || time.Now().Before(current.expiry)) {
+		return current, nil
+	}
+	output, err := runExecPlugin(ctx, c.config.user.Exec)
+	if err != nil {
+		return nil, err
+	}
+	refreshed := &credential{authorization: c.authorization}
+	if output.Status.Token != "" {
+		refreshed.authorization = "Bearer " + output.Status.Token
+	}
+	if output.Status.ClientCertificateData != "" {
+		certificate, err := tls.X509KeyPair([]byte(output.Status.ClientCertificateData), []byte(output.Status.ClientKeyData))
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate of credential plugin %s: %w", c.config.user.Exec.Command, err)
+		}
+		refreshed.certificate = &certificate
+	}
+	if output.Status.ExpirationTimestamp != nil {
+		refreshed.expiry = *output.Status.ExpirationTimestamp
+	}
+	if current != nil && current.certificate != nil && c.httpClient != nil {
+		// the connections made with the previous certificate keep using it
+		c.httpClient.CloseIdleConnections()
+	}
+	c.credential = refreshed
+	return refreshed, nil
+}
+
+// runExecPlugin runs the credential plugin and returns the credential it
+// wrote to stdout.
+func runExecPlugin(ctx context.Context, config *ExecConfig) (*execCredential, error) {
+	cmd := exec.CommandContext(ctx, config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range config.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	execInfo, err := json.Marshal(map[string]any{
+		"apiVersion": config.APIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(execInfo))
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run credential plugin %s: %w", config.Command, err)
+	}
+	credential := &execCredential{}
+	if err := json.Unmarshal(output, credential); err != nil {
+		return nil, fmt.Errorf("could not parse the output of credential plugin %s: %w", config.Command, err)
+	}
+	return credential, nil
+}
+
+// get sends a GET request to the API server and decodes the JSON response
+// into v.
+func (c *Client) get(ctx context.Context, requestPath string, query url.Values, v any) error {
+	return c.getAs(ctx, requestPath, query, "application/json", v)
+}
+
+// getAs is like get, with the given Accept header.
+func (c *Client) getAs(ctx context.Context, requestPath string, query url.Values, accept string, v any) error {
+	if err := c.setup(ctx); err != nil {
+		return err
+	}
+	var rejected *credential
+	for {
+		var credential *credential
+		if c.config.user.Exec != nil {
+			var err error
+			if credential, err = c.execCredential(ctx, rejected); err != nil {
+				return err
+			}
+		}
+		err := c.doGet(ctx, requestPath, query, accept, credential, v)
+		var statusErr *StatusError
+		if credential == nil || rejected != nil || !errors.As(err, &statusErr) || statusErr.Code != http.StatusUnauthorized {
+			return err
+		}
+		// the credential was revoked or expired before its expiration
+		// timestamp, the plugin is run again once
+		rejected = credential
+	}
+}
+
+// doGet sends the GET request with the credential of the credential plugin, if
+// any.
+func (c *Client) doGet(ctx context.Context, requestPath string, query url.Values, accept string, credential *credential, v any) error {
+	requestURL := strings.TrimSuffix(c.config.cluster.Server, "/") + requestPath
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", accept)
+	request.Header.Set("User-Agent", "kubectl-fetch")
+	authorization := c.authorization
+	if credential != nil {
+		authorization = credential.authorization
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	as, asGroups := c.config.user.As, c.config.user.AsGroups
+	if c.overrides.As != "" || len(c.overrides.AsGroups) > 0 {
+		as, asGroups = c.overrides.As, c.overrides.AsGroups
+	}
+	if as != "" {
+		request.Header.Set("Impersonate-User", as)
+	}
+	for _, group := range asGroups {
+		request.Header.Add("Impersonate-Group", group)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(body))
+		}
+		return &StatusError{Code: response.StatusCode, Message: status.Message}
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("could not parse the response of %s: %w", requestPath, err)
+	}
+	return nil
+}
+
+// discover lists the kinds served by the API server, with the preferred
+// version of each API group. Only the first call does the discovery.
+func (c *Client) discover(ctx context.Context) error {
+	c.discoveryOnce.Do(func() {
+		c.discoveryErr = c.doDiscover(ctx)
+	})
+	return c.discoveryErr
+}
+
+func (c *Client) doDiscover(ctx context.Context) error {
+	var apiVersions struct {
+		Versions []string `json:"versions"`
+	}
+	if err := c.get(ctx, "/api", nil, &apiVersions); err != nil {
+		return err
+	}
+	var apiGroups struct {
+		Groups []struct {
+			PreferredVersion struct {
+				GroupVersion string `json:"groupVersion"`
+			} `json:"preferredVersion"`
+		} `json:"groups"`
+	}
+	if err := c.get(ctx, "/apis", nil, &apiGroups); err != nil {
+		return err
+	}
+	var groupVersions []string
+	if len(apiVersions.Versions) > 0 {
+		groupVersions = append(groupVersions, apiVersions.Versions[0])
+	}
+	for _, group := range apiGroups.Groups {
+		groupVersions = append(groupVersions, group.PreferredVersion.GroupVersion)
+	}
+	resourcesPerGroupVersion := make([][]*apiResource, len(groupVersions))
+	errs := make([]error, len(groupVersions))
+	var wg sync.WaitGroup
+	for i, groupVersion := range groupVersions {
+		wg.Add(1)
+		go func(i int, groupVersion string) {
+			defer wg.Done()
+			resourcesPerGroupVersion[i], errs[i] = c.discoverGroupVersion(ctx, groupVersion)
+		}(i, groupVersion)
+	}
+	wg.Wait()
+	c.apiResources = make(map[string]*apiResource)
+	var failedGroups []string
+	for i, resources := range resourcesPerGroupVersion {
+		if errs[i] != nil {
+			failedGroups = append(failedGroups, groupVersions[i]+": "+errs[i].Error())
+			continue
+		}
+		for _, resource := range resources {
+			c.apiResources[resource.name] = resource
+		}
+	}
+	if len(failedGroups) > 0 {
+		// like kubectl, the groups that could be discovered are usable
+		return &kubectl.PartialDiscoveryError{
+			Message: "unable to retrieve the complete list of server APIs: " + strings.Join(failedGroups, ", "),
+		}
+	}
+	return nil
+}
+
+func (c *Client) discoverGroupVersion(ctx context.Context, groupVersion string) ([]*apiResource, error) {
+	discoveryPath := "/apis/" + groupVersion
+	if !strings.Contains(groupVersion, "/") {
+		discoveryPath = "/api/" + groupVersion
+	}
+	var resourceList struct {
+		Resources []struct {
+			Name       string   `json:"name"`
+			Namespaced bool     `json:"namespaced"`
+			Kind       string   `json:"kind"`
+			Verbs      []string `json:"verbs"`
+		} `json:"resources"`
+	}
+	if err := c.get(ctx, discoveryPath, nil, &resourceList); err != nil {
+		return nil, err
+	}
+	group, _, _ := strings.Cut(groupVersion, "/")
+	if !strings.Contains(groupVersion, "/") {
+		group = ""
+	}
+	var resources []*apiResource
+	for _, resource := range resourceList.Resources {
+		// subresources, e.g. pods/log, can't be listed
+		if strings.Contains(resource.Name, "/") || !contains(resource.Verbs, "list") {
+			continue
+		}
+		name := resource.Name
+		if group != "" {
+			name += "." + group
+		}
+		resources = append(resources, &apiResource{
+			name:         name,
+			resource:     resource.Name,
+			groupVersion: groupVersion,
+			kind:         resource.Kind,
+			namespaced:   resource.Namespaced,
+		})
+	}
+	return resources, nil
+}
+
+// ListApiResources returns the sorted names of the kinds that can be listed,
+// in the same format as `kubectl api-resources -o name`. If `namespaced` is
+// true, then only the kinds that live in namespaces are returned, otherwise
+// only the cluster-scoped kinds are returned.
+func (c *Client) ListApiResources(ctx context.Context, namespaced bool) ([]string, error) {
+	err := c.discover(ctx)
+	var partialErr *kubectl.PartialDiscoveryError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, err
+	}
+	var names []string
+	for name, resource := range c.apiResources {
+		if resource.namespaced == namespaced {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, err
+}
+
+// apiResource returns the discovered kind with the given name.
+func (c *Client) apiResource(ctx context.Context, kind string) (*apiResource, error) {
+	err := c.discover(ctx)
+	var partialErr *kubectl.PartialDiscoveryError
+	if err != nil && !errors.As(err, &partialErr) {
+		return nil, err
+	}
+	resource, found := c.apiResources[kind]
+	if !found {
+		return nil, fmt.Errorf("the server doesn't have a resource type %q", kind)
+	}
+	return resource, nil
+}
+
+// ListContexts returns the sorted names of the contexts of the kubeconfig.
+func (c *Client) ListContexts(ctx context.Context) ([]string, error) {
+	return c.kubeconfig.ContextNames(), nil
+}
+
+// ListNamespaces returns the sorted names of the namespaces of the cluster.
+func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
+	namespaces := &apiResource{resource: "namespaces", groupVersion: "v1", kind: "Namespace"}
+	resources, err := c.list(ctx, "namespaces", namespaces, "", false)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, resource.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetNamespacedResources returns the resouces in the given namespace.
+func (c *Client) GetNamespacedResources(ctx context.Context, namespace, kind string) ([]*kubectl.Resource, error) {
+	return c.getResources(ctx, kind, func(*restConfig) string { return namespace })
+}
+
+// GetAllNamespacesResources returns the resources of the given kind across
+// all namespaces.
+func (c *Client) GetAllNamespacesResources(ctx context.Context, kind string) ([]*kubectl.Resource, error) {
+	return c.getResources(ctx, kind, func(*restConfig) string { return "" })
+}
+
+// GetResources returns the resources of the given kind in the namespace of
+// the context, or the non-namespaced resources if the kind isn't namespaced.
+func (c *Client) GetResources(ctx context.Context, kind string) ([]*kubectl.Resource, error) {
+	return c.getResources(ctx, kind, func(config *restConfig) string { return config.namespace })
+}
+
+// getResources lists the resources of the kind in the namespace returned by
+// `namespace`, which is called once the kubeconfig is resolved.
+func (c *Client) getResources(ctx context.Context, kind string, namespace func(*restConfig) string) ([]*kubectl.Resource, error) {
+	resource, err := c.apiResource(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := c.list(ctx, kind, resource, namespace(c.config), true)
+	if err != nil {
+		return nil, err
+	}
+	kubectl.SortResources(resources)
+	return resources, nil
+}
+
+// list gets all the pages of the resources of the kind. The selectors are
+// only used when `filter` is true.
+func (c *Client) list(ctx context.Context, kind string, resource *apiResource, namespace string, filter bool) ([]*kubectl.Resource, error) {
+	query := url.Values{"limit": {strconv.Itoa(pageSize)}}
+	if filter && c.LabelSelector != "" {
+		query.Set("labelSelector", c.LabelSelector)
+	}
+	if filter && c.FieldSelector != "" {
+		query.Set("fieldSelector", c.FieldSelector)
+	}
+	accept := metadataAccept
+	if c.FullObjects {
+		accept = "application/json"
+	}
+	var resources []*kubectl.Resource
+	for {
+		var list struct {
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}
+		err := c.getAs(ctx, resource.path(namespace), query, accept, &list)
+		var statusErr *StatusError
+		if filter && c.FieldSelector != "" && errors.As(err, &statusErr) && kubectl.IsFieldSelectorNotSupported(statusErr.Message) {
+			return nil, &kubectl.FieldSelectorNotSupportedError{Kind: kind, FieldSelector: c.FieldSelector}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range list.Items {
+			item, err := kubectl.DecodeResource(data, c.FullObjects)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse the %s: %w", kind, err)
+			}
+			// the items of a list don't have an apiVersion nor a kind, and
+			// they're PartialObjectMetadata when only listing the metadata
+			item.APIVersion = resource.groupVersion
+			item.Kind = resource.kind
+			item.Resource = resource.resource
+			resources = append(resources, item)
+		}
+		if list.Metadata.Continue == "" {
+			return resources, nil
+		}
+		query.Set("continue", list.Metadata.Continue)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,360 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/rest"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+// apiServer is a stand-in for the kubernetes API server. It serves the
+// discovery documents and the lists of the `responses` map, indexed by path
+// and continue token.
+type apiServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	// revoked are the Authorization headers that the server rejects
+	revoked map[string]bool
+}
+
+var responses = map[string]string{
+	"/api": `{"kind":"APIVersions","versions":["v1"]}`,
+	"/api/v1": `{"groupVersion":"v1","resources":[
+		{"name":"bindings","namespaced":true,"kind":"Binding","verbs":["create"]},
+		{"name":"namespaces","namespaced":false,"kind":"Namespace","verbs":["get","list"]},
+		{"name":"pods","namespaced":true,"kind":"Pod","verbs":["get","list"]},
+		{"name":"pods/log","namespaced":true,"kind":"Pod","verbs":["get"]}]}`,
+	"/apis": `{"kind":"APIGroupList","groups":[
+		{"name":"apps","preferredVersion":{"groupVersion":"apps/v1","version":"v1"}},
+		{"name":"metrics.k8s.io","preferredVersion":{"groupVersion":"metrics.k8s.io/v1beta1","version":"v1beta1"}}]}`,
+	"/apis/apps/v1": `{"groupVersion":"apps/v1","resources":[
+		{"name":"deployments","namespaced":true,"kind":"Deployment","verbs":["get","list"]},
+		{"name":"deployments/scale","namespaced":true,"kind":"Scale","verbs":["get"]}]}`,
+	"/api/v1/namespaces": `{"kind":"NamespaceList","metadata":{},"items":[
+		{"metadata":{"name":"kube-system"}},{"metadata":{"name":"default"}}]}`,
+	"/api/v1/namespaces/team-a/pods": `{"kind":"PodList","metadata":{"continue":"page2"},"items":[
+		{"metadata":{"name":"foo","namespace":"team-a"},"status":{"phase":"Running"}}]}`,
+	"/api/v1/namespaces/team-a/pods?page2": `{"kind":"PodList","metadata":{},"items":[
+		{"metadata":{"name":"bar","namespace":"team-a"}}]}`,
+	"/apis/apps/v1/deployments": `{"kind":"DeploymentList","metadata":{},"items":[
+		{"metadata":{"name":"web","namespace":"b"}},{"metadata":{"name":"api","namespace":"a"}}]}`,
+}
+
+func newAPIServer(t *testing.T) *apiServer {
+	s := &apiServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		revoked := s.revoked[r.Header.Get("Authorization")]
+		s.mu.Unlock()
+		if revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"kind":"Status","message":"Unauthorized"}`)
+			return
+		}
+		key := r.URL.Path
+		if token := r.URL.Query().Get("continue"); token != "" {
+			key += "?" + token
+		}
+		if strings.HasPrefix(r.URL.Path, "/apis/metrics.k8s.io") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"kind":"Status","message":"the server is currently unable to handle the request"}`)
+			return
+		}
+		if fieldSelector := r.URL.Query().Get("fieldSelector"); strings.HasPrefix(fieldSelector, "status.") && r.URL.Path == "/apis/apps/v1/deployments" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"kind":"Status","message":"\"status.phase\" is not a known field selector: only \"metadata.name\", \"metadata.namespace\""}`)
+			return
+		}
+		response, found := responses[key]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","message":"the server could not find the requested resource"}`)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// lastRequest returns the last request made to the given path.
+func (s *apiServer) lastRequest(path string) *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.requests) - 1; i >= 0; i-- {
+		if s.requests[i].URL.Path == path {
+			return s.requests[i]
+		}
+	}
+	return nil
+}
+
+// writeKubeconfig writes a kubeconfig for the server with a context named
+// `test` whose namespace is team-a, and returns its path.
+func (s *apiServer) writeKubeconfig(t *testing.T) string {
+	return s.writeKubeconfigWithUser(t, "    token: secret\n")
+}
+
+// writeKubeconfigWithUser is like writeKubeconfig, with the given user
+// settings.
+func (s *apiServer) writeKubeconfigWithUser(t *testing.T, user string) string {
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    namespace: team-a
+    user: test
+- name: other
+  context:
+    cluster: missing
+users:
+- name: test
+  user:
+%s`, s.URL, base64.StdEncoding.EncodeToString(caData), user)
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newClient(t *testing.T, overrides rest.Overrides) (*rest.Client, *apiServer) {
+	server := newAPIServer(t)
+	kubeconfig, err := rest.LoadKubeconfig(server.writeKubeconfig(t))
+	assert.Nil(t, err)
+	return rest.New(kubeconfig, overrides), server
+}
+
+// credentialPluginEnv is set when the test binary is run as a credential
+// plugin, to the file counting the runs of the plugin.
+const credentialPluginEnv = "REST_TEST_CREDENTIAL_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if countFile := os.Getenv(credentialPluginEnv); countFile != "" {
+		os.Exit(runCredentialPlugin(countFile))
+	}
+	os.Exit(m.Run())
+}
+
+// runCredentialPlugin writes a credential whose token is the number of runs,
+// e.g. token-2 on the second run, which expires at the time in
+// REST_TEST_CREDENTIAL_EXPIRY.
+func runCredentialPlugin(countFile string) int {
+	count, _ := os.ReadFile(countFile)
+	runs := len(count) + 1
+	if err := os.WriteFile(countFile, append(count, '.'), 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf(`{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"token-%d","expirationTimestamp":%q}}`, runs, os.Getenv("REST_TEST_CREDENTIAL_EXPIRY"))
+	return 0
+}
+
+// newExecClient returns a client whose user gets its credential from the
+// test binary run as a credential plugin, and the file counting its runs.
+func newExecClient(t *testing.T, expiry string) (*rest.Client, *apiServer, string) {
+	server := newAPIServer(t)
+	countFile := filepath.Join(t.TempDir(), "runs")
+	kubeconfig, err := rest.LoadKubeconfig(server.writeKubeconfigWithUser(t, fmt.Sprintf(`    exec:
+      apiVersion: client.authentication.k8s.io/v1
+      command: %q
+      env:
+      - name: %s
+        value: %q
+      - name: REST_TEST_CREDENTIAL_EXPIRY
+        value: %q
+`, os.Args[0], credentialPluginEnv, countFile, expiry)))
+	assert.Nil(t, err)
+	return rest.New(kubeconfig, rest.Overrides{}), server, countFile
+}
+
+// pluginRuns returns the number of times the credential plugin ran.
+func pluginRuns(t *testing.T, countFile string) int {
+	count, err := os.ReadFile(countFile)
+	assert.Nil(t, err)
+	return len(count)
+}
+
+func resourceNames(resources []*kubectl.Resource) []string {
+	var names []string
+	for _, resource := range resources {
+		names = append(names, resource.Namespace()+"/"+resource.String())
+	}
+	return names
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	t.Run("discovers the kinds that can be listed", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		namespaced, err := client.ListApiResources(context.Background(), true)
+		var partialErr *kubectl.PartialDiscoveryError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Contains(t, partialErr.Message, "metrics.k8s.io/v1beta1: the server is currently unable to handle the request")
+		assert.SliceEquals(t, []string{"deployments.apps", "pods"}, namespaced)
+		clusterScoped, _ := client.ListApiResources(context.Background(), false)
+		assert.SliceEquals(t, []string{"namespaces"}, clusterScoped)
+	})
+
+	t.Run("lists all the pages of the resources in the namespace of the context", func(t *testing.T) {
+		client, server := newClient(t, rest.Overrides{})
+		client.LabelSelector = "app=payments"
+		client.FullObjects = true
+		resources, err := client.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"team-a/pod/bar", "team-a/pod/foo"}, resourceNames(resources))
+		assert.Equals(t, "v1", resources[1].APIVersion)
+		assert.Equals(t, "pods", resources[1].Resource)
+		assert.Equals(t, "Running", resources[1].Status())
+		request := server.lastRequest("/api/v1/namespaces/team-a/pods")
+		assert.Equals(t, "Bearer secret", request.Header.Get("Authorization"))
+		assert.Equals(t, "app=payments", request.URL.Query().Get("labelSelector"))
+		assert.Equals(t, "500", request.URL.Query().Get("limit"))
+		assert.Equals(t, "application/json", request.Header.Get("Accept"))
+		assert.Contains(t, string(resources[1].Raw), `"phase":"Running"`)
+	})
+
+	t.Run("only lists the metadata by default", func(t *testing.T) {
+		client, server := newClient(t, rest.Overrides{})
+		resources, err := client.GetResources(context.Background(), "pods")
+		assert.Nil(t, err)
+		assert.Equals(t, 0, len(resources[0].Raw))
+		request := server.lastRequest("/api/v1/namespaces/team-a/pods")
+		assert.Contains(t, request.Header.Get("Accept"), "as=PartialObjectMetadataList;g=meta.k8s.io;v=v1")
+		assert.Equals(t, "application/json", server.lastRequest("/api/v1").Header.Get("Accept"))
+	})
+
+	t.Run("lists the resources of a namespace", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		resources, err := client.GetNamespacedResources(context.Background(), "team-a", "pods")
+		assert.Nil(t, err)
+		assert.Equals(t, 2, len(resources))
+	})
+
+	t.Run("lists the resources across all namespaces", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		resources, err := client.GetAllNamespacesResources(context.Background(), "deployments.apps")
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"a/deployment.apps/api", "b/deployment.apps/web"}, resourceNames(resources))
+		assert.Equals(t, "apps/v1", resources[0].APIVersion)
+		assert.Equals(t, "Deployment", resources[0].Kind)
+	})
+
+	t.Run("returns a specific error when a kind doesn't support the field selector", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		client.FieldSelector = "status.phase=Running"
+		_, err := client.GetAllNamespacesResources(context.Background(), "deployments.apps")
+		var notSupportedErr *kubectl.FieldSelectorNotSupportedError
+		assert.True(t, errors.As(err, &notSupportedErr))
+		assert.Equals(t, "deployments.apps", notSupportedErr.Kind)
+	})
+
+	t.Run("returns an error for unknown kinds", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		_, err := client.GetResources(context.Background(), "widgets.example.com")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "widgets.example.com")
+	})
+
+	t.Run("lists the namespaces and the contexts", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{})
+		namespaces, err := client.ListNamespaces(context.Background())
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"default", "kube-system"}, namespaces)
+		contexts, err := client.ListContexts(context.Background())
+		assert.Nil(t, err)
+		assert.SliceEquals(t, []string{"other", "test"}, contexts)
+	})
+
+	t.Run("impersonates the user and groups", func(t *testing.T) {
+		client, server := newClient(t, rest.Overrides{As: "jane", AsGroups: []string{"devs", "ops"}})
+		_, err := client.ListNamespaces(context.Background())
+		assert.Nil(t, err)
+		request := server.lastRequest("/api/v1/namespaces")
+		assert.Equals(t, "jane", request.Header.Get("Impersonate-User"))
+		assert.SliceEquals(t, []string{"devs", "ops"}, request.Header.Values("Impersonate-Group"))
+	})
+
+	t.Run("returns an error when the context can't be resolved", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{Context: "other"})
+		_, err := client.ListApiResources(context.Background(), true)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), `cluster "missing" not found`)
+		client, _ = newClient(t, rest.Overrides{Context: "nope"})
+		_, err = client.GetResources(context.Background(), "pods")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), `context "nope" not found`)
+	})
+
+	t.Run("reuses the credential of the credential plugin until it expires", func(t *testing.T) {
+		tests := []struct {
+			expiry       string
+			expectedRuns int
+		}{
+			{"2999-01-01T00:00:00Z", 1},
+			// setup runs the plugin, then every request finds it expired
+			{"2000-01-01T00:00:00Z", 3},
+		}
+		for _, test := range tests {
+			client, server, countFile := newExecClient(t, test.expiry)
+			for i := 0; i < 2; i++ {
+				_, err := client.ListNamespaces(context.Background())
+				assert.Nil(t, err)
+			}
+			assert.Equals(t, test.expectedRuns, pluginRuns(t, countFile))
+			expectedToken := fmt.Sprintf("Bearer token-%d", test.expectedRuns)
+			assert.Equals(t, expectedToken, server.lastRequest("/api/v1/namespaces").Header.Get("Authorization"))
+		}
+	})
+
+	t.Run("runs the credential plugin again when the server rejects its credential", func(t *testing.T) {
+		client, server, countFile := newExecClient(t, "2999-01-01T00:00:00Z")
+		server.mu.Lock()
+		server.revoked = map[string]bool{"Bearer token-1": true}
+		server.mu.Unlock()
+		_, err := client.ListNamespaces(context.Background())
+		assert.Nil(t, err)
+		assert.Equals(t, 2, pluginRuns(t, countFile))
+		assert.Equals(t, "Bearer token-2", server.lastRequest("/api/v1/namespaces").Header.Get("Authorization"))
+
+		// the new credential is only retried once
+		server.mu.Lock()
+		server.revoked["Bearer token-2"] = true
+		server.revoked["Bearer token-3"] = true
+		server.mu.Unlock()
+		_, err = client.ListNamespaces(context.Background())
+		var statusErr *rest.StatusError
+		assert.True(t, errors.As(err, &statusErr))
+		assert.Equals(t, http.StatusUnauthorized, statusErr.Code)
+		assert.Equals(t, 3, pluginRuns(t, countFile))
+	})
+
+	t.Run("returns an error for an invalid request timeout", func(t *testing.T) {
+		client, _ := newClient(t, rest.Overrides{RequestTimeout: "soon"})
+		_, err := client.ListNamespaces(context.Background())
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,267 @@
+// Package rest talks to the Kubernetes API server directly over HTTP, using
+// the credentials of the kubeconfig, instead of running kubectl.
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+// Kubeconfig is the subset of the kubeconfig that's needed to connect to the
+// clusters.
+type Kubeconfig struct {
+	CurrentContext string         `json:"current-context"`
+	Clusters       []NamedCluster `json:"clusters"`
+	Contexts       []NamedContext `json:"contexts"`
+	Users          []NamedUser    `json:"users"`
+}
+
+type NamedCluster struct {
+	Name    string  `json:"name"`
+	Cluster Cluster `json:"cluster"`
+}
+
+type Cluster struct {
+	Server                   string `json:"server"`
+	CertificateAuthority     string `json:"certificate-authority"`
+	CertificateAuthorityData []byte `json:"certificate-authority-data"`
+	InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+	TLSServerName            string `json:"tls-server-name"`
+	ProxyURL                 string `json:"proxy-url"`
+}
+
+type NamedContext struct {
+	Name    string  `json:"name"`
+	Context Context `json:"context"`
+}
+
+type Context struct {
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace"`
+}
+
+type NamedUser struct {
+	Name string `json:"name"`
+	User User   `json:"user"`
+}
+
+type User struct {
+	ClientCertificate     string   `json:"client-certificate"`
+	ClientCertificateData []byte   `json:"client-certificate-data"`
+	ClientKey             string   `json:"client-key"`
+	ClientKeyData         []byte   `json:"client-key-data"`
+	Token                 string   `json:"token"`
+	TokenFile             string   `json:"tokenFile"`
+	Username              string   `json:"username"`
+	Password              string   `json:"password"`
+	As                    string   `json:"as"`
+	AsGroups              []string `json:"as-groups"`
+	// AuthProvider is only used to report that it isn't supported
+	AuthProvider *struct {
+		Name string `json:"name"`
+	} `json:"auth-provider"`
+	Exec *ExecConfig `json:"exec"`
+}
+
+// ExecConfig is a credential plugin, e.g. `aws eks get-token`.
+type ExecConfig struct {
+	APIVersion string   `json:"apiVersion"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Env        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"env"`
+}
+
+// LoadKubeconfig loads the kubeconfig like kubectl does: from the given path
+// if it's not empty, otherwise from the files listed in the KUBECONFIG
+// environment variable, otherwise from ~/.kube/config. When many files are
+// listed, the first file to set a value wins. Relative paths are resolved
+// against the directory of the file they're found in.
+func LoadKubeconfig(path string) (*Kubeconfig, error) {
+	if path != "" {
+		return loadKubeconfigFile(path)
+	}
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		merged := &Kubeconfig{}
+		for _, path := range filepath.SplitList(env) {
+			if path == "" {
+				continue
+			}
+			kubeconfig, err := loadKubeconfigFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				// like kubectl, missing files are ignored
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			merged.merge(kubeconfig)
+		}
+		return merged, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not find the kubeconfig: %w", err)
+	}
+	return loadKubeconfigFile(filepath.Join(home, ".kube", "config"))
+}
+
+func loadKubeconfigFile(path string) (*Kubeconfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read kubeconfig: %w", err)
+	}
+	kubeconfig := &Kubeconfig{}
+	if err := yaml.Unmarshal(data, kubeconfig); err != nil {
+		return nil, fmt.Errorf("could not parse kubeconfig %s: %w", path, err)
+	}
+	kubeconfig.resolvePaths(filepath.Dir(path))
+	return kubeconfig, nil
+}
+
+// resolvePaths makes the relative paths of the kubeconfig relative to the
+// given directory.
+func (k *Kubeconfig) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	for i := range k.Clusters {
+		resolve(&k.Clusters[i].Cluster.CertificateAuthority)
+	}
+	for i := range k.Users {
+		user := &k.Users[i].User
+		resolve(&user.ClientCertificate)
+		resolve(&user.ClientKey)
+		resolve(&user.TokenFile)
+	}
+}
+
+// merge adds the values of the other kubeconfig that aren't already set.
+func (k *Kubeconfig) merge(other *Kubeconfig) {
+	if k.CurrentContext == "" {
+		k.CurrentContext = other.CurrentContext
+	}
+	for _, cluster := range other.Clusters {
+		if k.cluster(cluster.Name) == nil {
+			k.Clusters = append(k.Clusters, cluster)
+		}
+	}
+	for _, context := range other.Contexts {
+		if k.context(context.Name) == nil {
+			k.Contexts = append(k.Contexts, context)
+		}
+	}
+	for _, user := range other.Users {
+		if k.user(user.Name) == nil {
+			k.Users = append(k.Users, user)
+		}
+	}
+}
+
+// ContextNames returns the sorted names of the contexts.
+func (k *Kubeconfig) ContextNames() []string {
+	names := make([]string, 0, len(k.Contexts))
+	for _, context := range k.Contexts {
+		names = append(names, context.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (k *Kubeconfig) cluster(name string) *Cluster {
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == name {
+			return &k.Clusters[i].Cluster
+		}
+	}
+	return nil
+}
+
+func (k *Kubeconfig) context(name string) *Context {
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == name {
+			return &k.Contexts[i].Context
+		}
+	}
+	return nil
+}
+
+func (k *Kubeconfig) user(name string) *User {
+	for i := range k.Users {
+		if k.Users[i].Name == name {
+			return &k.Users[i].User
+		}
+	}
+	return nil
+}
+
+// Overrides are the kubectl global flags that override the kubeconfig.
+type Overrides struct {
+	Context        string
+	Cluster        string
+	User           string
+	As             string
+	AsGroups       []string
+	RequestTimeout string
+}
+
+// restConfig is what's needed to connect to a cluster, once the kubeconfig
+// and the overrides are resolved.
+type restConfig struct {
+	cluster   *Cluster
+	user      *User
+	namespace string
+}
+
+// resolve returns the cluster and user to connect with, according to the
+// overrides and the current context.
+func (k *Kubeconfig) resolve(overrides Overrides) (*restConfig, error) {
+	contextName := overrides.Context
+	if contextName == "" {
+		contextName = k.CurrentContext
+	}
+	context := &Context{}
+	if contextName != "" {
+		if context = k.context(contextName); context == nil {
+			return nil, fmt.Errorf("context %q not found in the kubeconfig", contextName)
+		}
+	}
+	clusterName, userName := context.Cluster, context.User
+	if overrides.Cluster != "" {
+		clusterName = overrides.Cluster
+	}
+	if overrides.User != "" {
+		userName = overrides.User
+	}
+	if clusterName == "" {
+		return nil, errors.New("no cluster is configured, set the current context of the kubeconfig or use --context")
+	}
+	cluster := k.cluster(clusterName)
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster %q not found in the kubeconfig", clusterName)
+	}
+	if cluster.Server == "" {
+		return nil, fmt.Errorf("cluster %q has no server", clusterName)
+	}
+	user := &User{}
+	if userName != "" {
+		if user = k.user(userName); user == nil {
+			return nil, fmt.Errorf("user %q not found in the kubeconfig", userName)
+		}
+	}
+	namespace := context.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	return &restConfig{cluster: cluster, user: user, namespace: namespace}, nil
+}
@@ -0,0 +1,77 @@
+package rest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/rest"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Not parallel since it sets the KUBECONFIG environment variable.
+func TestLoadKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first", "config")
+	writeFile(t, first, `current-context: a
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+    certificate-authority: ca.crt
+contexts:
+- name: a
+  context:
+    cluster: a
+users:
+- name: a
+  user:
+    tokenFile: /var/run/token
+`)
+	second := filepath.Join(dir, "second.yaml")
+	writeFile(t, second, `current-context: b
+clusters:
+- name: a
+  cluster:
+    server: https://ignored.example.com
+- name: b
+  cluster:
+    server: https://b.example.com
+contexts:
+- name: b
+  context:
+    cluster: b
+`)
+
+	t.Run("merges the files of the KUBECONFIG environment variable", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", first+string(os.PathListSeparator)+filepath.Join(dir, "missing")+string(os.PathListSeparator)+second)
+		kubeconfig, err := rest.LoadKubeconfig("")
+		assert.Nil(t, err)
+		assert.Equals(t, "a", kubeconfig.CurrentContext)
+		assert.SliceEquals(t, []string{"a", "b"}, kubeconfig.ContextNames())
+		assert.Equals(t, 2, len(kubeconfig.Clusters))
+		assert.Equals(t, "https://a.example.com", kubeconfig.Clusters[0].Cluster.Server)
+	})
+
+	t.Run("resolves relative paths against the directory of the file", func(t *testing.T) {
+		kubeconfig, err := rest.LoadKubeconfig(first)
+		assert.Nil(t, err)
+		assert.Equals(t, filepath.Join(dir, "first", "ca.crt"), kubeconfig.Clusters[0].Cluster.CertificateAuthority)
+		assert.Equals(t, "/var/run/token", kubeconfig.Users[0].User.TokenFile)
+	})
+
+	t.Run("returns an error when the given file doesn't exist", func(t *testing.T) {
+		_, err := rest.LoadKubeconfig(filepath.Join(dir, "missing"))
+		assert.NotNil(t, err)
+	})
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type TermInfo interface {
@@ -16,8 +18,17 @@ type TermInfo interface {
 }
 
 type GetResourcesUpdate struct {
-	Kind      string
+	// Cluster is the kubeconfig context in which the resources were fetched,
+	// it's empty unless fetching from many contexts.
+	Cluster string
+	Kind    string
+	// Namespace is the namespace in which the resources were fetched, it's
+	// empty unless fetching from specific namespaces.
+	Namespace string
 	Resources int
+	// Namespaces contains the distinct namespaces in which resources were
+	// found, it's only set when fetching from more than one namespace.
+	Namespaces []string
 }
 
 type PBar interface {
@@ -29,6 +40,7 @@ type PBar interface {
 
 type UI struct {
 	getResourcesUpdates chan *GetResourcesUpdate
+	kindsPerCluster     map[string]int
 	nbExecs, nbTputs    int
 	progressBar         PBar
 	spinner             *Spinner
@@ -100,11 +112,20 @@ func (u *UI) flush() error {
 }
 
 func (u *UI) SetTotalKinds(count int) chan<- *GetResourcesUpdate {
-	u.totalKinds <- count
+	// create the channel before sending the count to Start, which reads it
+	// as soon as it receives the count
 	u.getResourcesUpdates = make(chan *GetResourcesUpdate, count)
+	u.totalKinds <- count
 	return u.getResourcesUpdates
 }
 
+// SetTotalKindsPerCluster sets the number of kinds to fetch in each cluster
+// when fetching from many contexts, so that the progress of each cluster is
+// displayed. It must be called before SetTotalKinds.
+func (u *UI) SetTotalKindsPerCluster(kindsPerCluster map[string]int) {
+	u.kindsPerCluster = kindsPerCluster
+}
+
 func (u *UI) Start(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done() // important: do this last
 	defer u.flush()
@@ -133,19 +154,34 @@ func (u *UI) Start(ctx context.Context, wg *sync.WaitGroup) {
 	var processedKinds int
 	var totalResourcesFound int
 	var lastProcessedKind string
+	namespacesFound := make(map[string]bool)
+	clusters := sortedKeys(u.kindsPerCluster)
+	processedKindsPerCluster := make(map[string]int)
+	resourcesPerCluster := make(map[string]int)
+	clusterWidth := maxLen(clusters)
 	formatWidth := len(strconv.Itoa(totalKinds))
 	eraseLine := u.queryTerminfo("el")
 	var progressLines []string
 	for {
 		u.tput("cup 0 0")
 		progressLines = []string{
-			fmt.Sprintf("Discovering kinds... found %d.\n", totalKinds),
-			fmt.Sprintf("\r%s Fetched kinds: %s %*d/%d\n",
+			fmt.Sprintf("Discovering kinds... found %d.", totalKinds),
+			fmt.Sprintf("\r%s Fetched kinds: %s %*d/%d",
 				u.spinner, u.progressBar.String(), formatWidth, processedKinds, totalKinds),
-			fmt.Sprintf("Getting %s\n", lastProcessedKind),
+			fmt.Sprintf("Getting %s", lastProcessedKind),
 			fmt.Sprintf("Total resources found: %4d", totalResourcesFound),
 		}
-		u.print(strings.Join(progressLines, eraseLine))
+		if len(namespacesFound) > 0 {
+			progressLines = append(progressLines,
+				fmt.Sprintf("Namespaces with resources: %4d", len(namespacesFound)))
+		}
+		for _, cluster := range clusters {
+			progressLines = append(progressLines,
+				fmt.Sprintf("  %-*s %*d/%d kinds, %4d resources", clusterWidth, cluster,
+					formatWidth, processedKindsPerCluster[cluster], u.kindsPerCluster[cluster],
+					resourcesPerCluster[cluster]))
+		}
+		u.print(strings.Join(progressLines, "\n"+eraseLine))
 		u.flush()
 		select {
 		case <-ctx.Done():
@@ -156,8 +192,120 @@ func (u *UI) Start(ctx context.Context, wg *sync.WaitGroup) {
 			}
 			u.progressBar.Increment(1)
 			lastProcessedKind = getResourcesUpdate.Kind
+			if getResourcesUpdate.Namespace != "" {
+				lastProcessedKind += " in " + getResourcesUpdate.Namespace
+			}
+			if getResourcesUpdate.Cluster != "" {
+				lastProcessedKind += " from " + getResourcesUpdate.Cluster
+			}
 			processedKinds++
 			totalResourcesFound += getResourcesUpdate.Resources
+			processedKindsPerCluster[getResourcesUpdate.Cluster]++
+			resourcesPerCluster[getResourcesUpdate.Cluster] += getResourcesUpdate.Resources
+			for _, namespace := range getResourcesUpdate.Namespaces {
+				namespacesFound[namespace] = true
+			}
+		case <-u.spinner.Tick:
+			u.spinner.Spin()
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func maxLen(values []string) int {
+	var longest int
+	for _, value := range values {
+		if len(value) > longest {
+			longest = len(value)
+		}
+	}
+	return longest
+}
+
+// feedLength is the number of events displayed in the live feed.
+const feedLength = 10
+
+// WatchEvent is a resource that was created or deleted while watching.
+type WatchEvent struct {
+	Time    time.Time
+	Created bool
+	// Kind is the kind of the resource in the `kubectl get -o name` format,
+	// e.g. deployment.apps
+	Kind string
+	// Name is the resource as printed by the plugin
+	Name string
+}
+
+func (e *WatchEvent) String() string {
+	sign := "-"
+	if e.Created {
+		sign = "+"
+	}
+	return e.Time.Format("15:04:05") + " " + sign + " " + e.Name
+}
+
+// Feed displays the latest watch events along with the number of resources
+// created and deleted per kind, until the events channel is closed or the
+// context is done.
+func (u *UI) Feed(ctx context.Context, wg *sync.WaitGroup, events <-chan *WatchEvent) {
+	defer wg.Done() // important: do this last
+	defer u.flush()
+	defer u.showCursor()
+	defer u.exitAlternateScreen()
+	u.hideCursor()
+	u.enterAlternateScreen()
+	var latestEvents []*WatchEvent
+	createdPerKind := make(map[string]int)
+	deletedPerKind := make(map[string]int)
+	eventsPerKind := make(map[string]int)
+	eraseLine := u.queryTerminfo("el")
+	for {
+		u.tput("cup 0 0")
+		feedLines := []string{
+			fmt.Sprintf("\r%s Watching for created and deleted resources, press Ctrl-C to stop", u.spinner),
+			"",
+			"Latest events:",
+		}
+		for _, event := range latestEvents {
+			feedLines = append(feedLines, "  "+event.String())
+		}
+		kinds := sortedKeys(eventsPerKind)
+		if len(kinds) > 0 {
+			feedLines = append(feedLines, "", "Events per kind:")
+		}
+		kindWidth := maxLen(kinds)
+		for _, kind := range kinds {
+			feedLines = append(feedLines,
+				fmt.Sprintf("  %-*s %4d created, %4d deleted", kindWidth, kind,
+					createdPerKind[kind], deletedPerKind[kind]))
+		}
+		u.print(strings.Join(feedLines, "\n"+eraseLine))
+		u.flush()
+		select {
+		case <-ctx.Done():
+			return
+		case event, more := <-events:
+			if !more {
+				return
+			}
+			if event.Created {
+				createdPerKind[event.Kind]++
+			} else {
+				deletedPerKind[event.Kind]++
+			}
+			eventsPerKind[event.Kind]++
+			latestEvents = append(latestEvents, event)
+			if len(latestEvents) > feedLength {
+				latestEvents = latestEvents[1:]
+			}
 		case <-u.spinner.Tick:
 			u.spinner.Spin()
 		}
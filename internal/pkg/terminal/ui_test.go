@@ -91,8 +91,8 @@ func TestUI_Start(t *testing.T) {
 		waitGroup.Add(1)
 		go ui.Start(ctx, &waitGroup)
 		updates := ui.SetTotalKinds(2)
-		updates <- &terminal.GetResourcesUpdate{"deployment", 5}
-		updates <- &terminal.GetResourcesUpdate{"services", 1}
+		updates <- &terminal.GetResourcesUpdate{Kind: "deployment", Resources: 5}
+		updates <- &terminal.GetResourcesUpdate{Kind: "services", Resources: 1}
 		time.Sleep(10 * time.Millisecond)
 		close(updates)
 		waitGroup.Wait()
@@ -100,4 +100,70 @@ func TestUI_Start(t *testing.T) {
 		assert.Contains(t, stderr.String(), "Discovering kinds... found 2.")
 		assert.Contains(t, stderr.String(), "Total resources found:    6")
 	})
+
+	t.Run("displays the number of namespaces when fetching across all namespaces", func(t *testing.T) {
+		pbar := &mockProgressBar{}
+		termInfo := &mockTermInfo{}
+		var stderr strings.Builder
+		spinner := terminal.NewSpinner(1 * time.Millisecond)
+		ui := terminal.NewUI(pbar, spinner, termInfo, &stderr)
+		var waitGroup sync.WaitGroup
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		waitGroup.Add(1)
+		go ui.Start(ctx, &waitGroup)
+		updates := ui.SetTotalKinds(2)
+		updates <- &terminal.GetResourcesUpdate{Kind: "configmaps", Resources: 3, Namespaces: []string{"a", "b"}}
+		updates <- &terminal.GetResourcesUpdate{Kind: "services", Resources: 2, Namespaces: []string{"b", "c"}}
+		time.Sleep(10 * time.Millisecond)
+		close(updates)
+		waitGroup.Wait()
+		assert.Contains(t, stderr.String(), "Namespaces with resources:    3")
+	})
+}
+
+func TestUI_SetTotalKindsPerCluster(t *testing.T) {
+	pbar := &mockProgressBar{}
+	termInfo := &mockTermInfo{}
+	var stderr strings.Builder
+	spinner := terminal.NewSpinner(1 * time.Millisecond)
+	ui := terminal.NewUI(pbar, spinner, termInfo, &stderr)
+	var waitGroup sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	waitGroup.Add(1)
+	go ui.Start(ctx, &waitGroup)
+	ui.SetTotalKindsPerCluster(map[string]int{"prod-eu": 2, "dev": 1})
+	updates := ui.SetTotalKinds(3)
+	updates <- &terminal.GetResourcesUpdate{Cluster: "prod-eu", Kind: "configmaps", Resources: 3}
+	updates <- &terminal.GetResourcesUpdate{Cluster: "dev", Kind: "configmaps", Resources: 2}
+	time.Sleep(10 * time.Millisecond)
+	close(updates)
+	waitGroup.Wait()
+	assert.Contains(t, stderr.String(), "  dev     1/1 kinds,    2 resources")
+	assert.Contains(t, stderr.String(), "  prod-eu 1/2 kinds,    3 resources")
+}
+
+func TestUI_Feed(t *testing.T) {
+	termInfo := &mockTermInfo{}
+	var stderr strings.Builder
+	spinner := terminal.NewSpinner(1 * time.Millisecond)
+	ui := terminal.NewUI(&mockProgressBar{}, spinner, termInfo, &stderr)
+	var waitGroup sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan *terminal.WatchEvent)
+	waitGroup.Add(1)
+	go ui.Feed(ctx, &waitGroup, events)
+	now := time.Date(2022, 6, 15, 12, 30, 0, 0, time.UTC)
+	events <- &terminal.WatchEvent{Time: now, Created: true, Kind: "pod", Name: "default/pod/web-1"}
+	events <- &terminal.WatchEvent{Time: now, Created: true, Kind: "configmap", Name: "default/configmap/settings"}
+	events <- &terminal.WatchEvent{Time: now.Add(time.Second), Kind: "pod", Name: "default/pod/web-0"}
+	close(events)
+	waitGroup.Wait()
+	assert.Contains(t, stderr.String(), "Watching for created and deleted resources")
+	assert.Contains(t, stderr.String(), "  12:30:00 + default/pod/web-1")
+	assert.Contains(t, stderr.String(), "  12:30:01 - default/pod/web-0")
+	assert.Contains(t, stderr.String(), "  configmap    1 created,    0 deleted")
+	assert.Contains(t, stderr.String(), "  pod          1 created,    1 deleted")
 }
@@ -0,0 +1,572 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Unmarshal decodes the first YAML document of data into the value pointed
+// to by v. Like Marshal, it goes through JSON so the json struct tags are
+// honored.
+//
+// Only the subset of YAML written by kubectl and the usual editors is
+// supported: block mappings and sequences, plain and quoted scalars, literal
+// and folded block scalars and flow collections that fit on a line. Anchors,
+// aliases and tags aren't supported. JSON documents are decoded as is.
+func Unmarshal(data []byte, v any) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return json.Unmarshal(trimmed, v)
+	}
+	d := newDecoder(data)
+	value, err := d.parseNode(-1)
+	if err != nil {
+		return err
+	}
+	if l := d.peek(); l != nil {
+		return fmt.Errorf("yaml: line %d: unexpected content %q", l.number, l.text)
+	}
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
+}
+
+// line is a line of the document.
+type line struct {
+	// number is the 1-based line number, for error messages
+	number int
+	indent int
+	// raw is the line as is, block scalars are made of raw lines
+	raw string
+	// text is the line without its indentation and comment
+	text string
+}
+
+type decoder struct {
+	lines []*line
+	pos   int
+}
+
+func newDecoder(data []byte) *decoder {
+	d := &decoder{}
+	// the line break ending the last line doesn't start another line, which
+	// a kept block scalar at the end of the document would take as a blank
+	// line
+	document := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	rawLines := strings.Split(document, "\n")
+	for i, raw := range rawLines {
+		trimmed := strings.TrimLeft(raw, " ")
+		l := &line{
+			number: i + 1,
+			indent: len(raw) - len(trimmed),
+			raw:    raw,
+			text:   strings.TrimSpace(stripComment(trimmed)),
+		}
+		if l.indent == 0 && (l.text == "---" || strings.HasPrefix(l.text, "--- ") || l.text == "...") {
+			if l.text == "..." || hasContent(d.lines) {
+				// only the first document is decoded
+				break
+			}
+			l.text = strings.TrimSpace(strings.TrimPrefix(l.text, "---"))
+		}
+		d.lines = append(d.lines, l)
+	}
+	return d
+}
+
+func hasContent(lines []*line) bool {
+	for _, l := range lines {
+		if l.text != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// stripComment removes the comment at the end of the line, if any.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			// escaped single quote
+			i++
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			// quotes only start a quoted scalar at the beginning of a value
+			if i == 0 || strings.IndexByte(" [{,:-", s[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+// peek returns the next line that isn't blank nor a comment, or nil at the
+// end of the document.
+func (d *decoder) peek() *line {
+	for d.pos < len(d.lines) && d.lines[d.pos].text == "" {
+		d.pos++
+	}
+	if d.pos == len(d.lines) {
+		return nil
+	}
+	return d.lines[d.pos]
+}
+
+// parseNode parses the node that starts at the next line. The node is part
+// of a collection indented by `parent` columns, -1 for the root node.
+func (d *decoder) parseNode(parent int) (any, error) {
+	l := d.peek()
+	if l == nil {
+		return nil, nil
+	}
+	if isSequenceItem(l.text) {
+		return d.parseSequence(l.indent)
+	}
+	if _, _, ok := splitMappingEntry(l.text); ok {
+		return d.parseMapping(l.indent)
+	}
+	d.pos++
+	return d.parseValue(l, l.text, parent)
+}
+
+func (d *decoder) parseSequence(indent int) ([]any, error) {
+	items := []any{}
+	for {
+		l := d.peek()
+		if l == nil || l.indent != indent || !isSequenceItem(l.text) {
+			return items, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		var item any
+		var err error
+		if rest == "" {
+			d.pos++
+			if next := d.peek(); next != nil && next.indent > indent {
+				item, err = d.parseNode(indent)
+			}
+		} else {
+			// the rest of the line is a node indented after the dash, parse
+			// the line again as if it only contained that node
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			item, err = d.parseNode(indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (d *decoder) parseMapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for {
+		l := d.peek()
+		if l == nil || l.indent != indent || isSequenceItem(l.text) {
+			return m, nil
+		}
+		key, value, ok := splitMappingEntry(l.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected a mapping entry, got %q", l.number, l.text)
+		}
+		if key, ok = parseKey(key); !ok {
+			return nil, fmt.Errorf("yaml: line %d: invalid key %q", l.number, key)
+		}
+		d.pos++
+		var v any
+		var err error
+		if value == "" {
+			// like kubectl, sequences can be at the same indentation as their key
+			if next := d.peek(); next != nil && (next.indent > indent || next.indent == indent && isSequenceItem(next.text)) {
+				v, err = d.parseNode(indent)
+			}
+		} else {
+			v, err = d.parseValue(l, value, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+// parseValue parses the value found on line `l`, which can be a block scalar
+// or a scalar continued on the next lines that are more indented than
+// `parent`.
+func (d *decoder) parseValue(l *line, value string, parent int) (any, error) {
+	if header := blockScalarRegex.FindStringSubmatch(value); header != nil {
+		return d.parseBlockScalar(header, parent)
+	}
+	for next := d.peek(); next != nil && next.indent > parent && !strings.HasPrefix(value, "[") && !strings.HasPrefix(value, "{"); next = d.peek() {
+		value += " " + next.text
+		d.pos++
+	}
+	p := &flowParser{s: value}
+	v, err := p.parse(false)
+	if err == nil && strings.TrimSpace(p.s[p.pos:]) != "" {
+		err = fmt.Errorf("unexpected %q", p.s[p.pos:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %d: %w", l.number, err)
+	}
+	return v, nil
+}
+
+// blockScalarRegex matches the header of literal and folded block scalars,
+// e.g. |- or >
+var blockScalarRegex = regexp.MustCompile(`^([|>])([-+]?)([1-9]?)([-+]?)$`)
+
+func (d *decoder) parseBlockScalar(header []string, parent int) (string, error) {
+	literal := header[1] == "|"
+	chomping := header[2] + header[4]
+	contentIndent := -1
+	if header[3] != "" {
+		contentIndent = parent + int(header[3][0]-'0')
+		if parent < 0 {
+			contentIndent++
+		}
+	}
+	var lines []string
+	for ; d.pos < len(d.lines); d.pos++ {
+		l := d.lines[d.pos]
+		if strings.TrimSpace(l.raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if contentIndent < 0 {
+			contentIndent = l.indent
+		}
+		if l.indent < contentIndent || l.indent <= parent {
+			break
+		}
+		lines = append(lines, l.raw[contentIndent:])
+	}
+	trailingBlanks := 0
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+		trailingBlanks++
+	}
+	// blank lines that aren't part of the scalar are back in the document
+	if chomping != "+" {
+		d.pos -= trailingBlanks
+		trailingBlanks = 0
+	}
+	var content string
+	if literal {
+		content = strings.Join(lines, "\n")
+	} else {
+		content = fold(lines)
+	}
+	switch {
+	case content == "" && chomping != "+":
+		return "", nil
+	case chomping == "-":
+		return content, nil
+	case chomping == "+":
+		return content + "\n" + strings.Repeat("\n", trailingBlanks), nil
+	default:
+		return content + "\n", nil
+	}
+}
+
+// fold joins the lines of a folded block scalar: consecutive lines are
+// joined by a space, blank lines are line breaks and more indented lines are
+// kept as is.
+func fold(lines []string) string {
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case l == "":
+				b.WriteString("\n")
+			case prev == "":
+				// the line break was replaced by the blank lines
+			case strings.HasPrefix(l, " ") || strings.HasPrefix(prev, " "):
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitMappingEntry splits a `key: value` line. The value is empty when it's
+// on the next lines.
+func splitMappingEntry(text string) (key, value string, ok bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	start := 0
+	if text[0] == '"' || text[0] == '\'' {
+		_, rest, err := parseQuoted(text)
+		if err != nil {
+			return "", "", false
+		}
+		start = len(text) - len(rest)
+	}
+	i := strings.Index(text[start:], ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		return text[:len(text)-1], "", true
+	}
+	i += start
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+2:]), true
+}
+
+func parseKey(key string) (string, bool) {
+	key = strings.TrimSpace(key)
+	if key == "" || key[0] != '"' && key[0] != '\'' {
+		return key, true
+	}
+	unquoted, rest, err := parseQuoted(key)
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return key, false
+	}
+	return unquoted, true
+}
+
+// flowParser parses the values written on a single line: scalars and flow
+// collections, e.g. [a, b] or {a: b}.
+type flowParser struct {
+	s   string
+	pos int
+}
+
+func (p *flowParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// parse parses the value at the current position. In a flow collection,
+// plain scalars end at the flow indicators.
+func (p *flowParser) parse(inFlow bool) (any, error) {
+	p.skipSpaces()
+	if p.pos == len(p.s) {
+		return nil, nil
+	}
+	switch p.s[p.pos] {
+	case '[':
+		return p.parseSequence()
+	case '{':
+		return p.parseMapping()
+	case '"', '\'':
+		value, rest, err := parseQuoted(p.s[p.pos:])
+		if err != nil {
+			return nil, err
+		}
+		p.pos = len(p.s) - len(rest)
+		return value, nil
+	}
+	if !inFlow {
+		value := strings.TrimSpace(p.s[p.pos:])
+		p.pos = len(p.s)
+		return resolvePlain(value), nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(",]}", rune(p.s[p.pos])) && !p.atMappingIndicator() {
+		p.pos++
+	}
+	return resolvePlain(strings.TrimSpace(p.s[start:p.pos])), nil
+}
+
+// atMappingIndicator returns true if the current position is the colon
+// between the key and value of a flow mapping entry.
+func (p *flowParser) atMappingIndicator() bool {
+	if p.s[p.pos] != ':' {
+		return false
+	}
+	return p.pos+1 == len(p.s) || strings.ContainsRune(" ,]}", rune(p.s[p.pos+1]))
+}
+
+func (p *flowParser) expect(c byte) error {
+	p.skipSpaces()
+	if p.pos == len(p.s) || p.s[p.pos] != c {
+		return fmt.Errorf("expected %q in %q", c, p.s)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *flowParser) parseSequence() ([]any, error) {
+	p.pos++ // [
+	items := []any{}
+	for {
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == ']' {
+			p.pos++
+			return items, nil
+		}
+		item, err := p.parse(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+func (p *flowParser) parseMapping() (map[string]any, error) {
+	p.pos++ // {
+	m := map[string]any{}
+	for {
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == '}' {
+			p.pos++
+			return m, nil
+		}
+		key, err := p.parse(true)
+		if err != nil {
+			return nil, err
+		}
+		keyString, ok := key.(string)
+		if !ok {
+			keyString = fmt.Sprint(key)
+		}
+		var value any
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == ':' {
+			p.pos++
+			if value, err = p.parse(true); err != nil {
+				return nil, err
+			}
+		}
+		m[keyString] = value
+		p.skipSpaces()
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+var (
+	// intRegex and floatRegex match the numbers that are valid JSON numbers
+	intRegex   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	floatRegex = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// resolvePlain returns the value of a plain scalar, following the YAML core
+// schema.
+func resolvePlain(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if intRegex.MatchString(s) || floatRegex.MatchString(s) {
+		return json.Number(s)
+	}
+	return s
+}
+
+// parseQuoted parses the single or double quoted scalar at the start of s and
+// returns its value and what follows it.
+func parseQuoted(s string) (string, string, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), s[i+1:], nil
+		case c == quote:
+			return b.String(), s[i+1:], nil
+		case c == '\\' && quote == '"':
+			n, err := unescape(&b, s[i+1:])
+			if err != nil {
+				return "", "", err
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated quoted scalar")
+}
+
+var escapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unescape writes the character of the escape sequence at the start of s,
+// after the backslash, and returns the length of the sequence.
+func unescape(b *strings.Builder, s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("unterminated escape sequence")
+	}
+	if escaped, found := escapes[s[0]]; found {
+		b.WriteString(escaped)
+		return 1, nil
+	}
+	var size int
+	switch s[0] {
+	case 'x':
+		size = 2
+	case 'u':
+		size = 4
+	case 'U':
+		size = 8
+	default:
+		return 0, fmt.Errorf("invalid escape sequence \\%c", s[0])
+	}
+	if len(s) < size+1 {
+		return 0, fmt.Errorf("invalid escape sequence \\%s", s)
+	}
+	code, err := strconv.ParseUint(s[1:size+1], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, fmt.Errorf("invalid escape sequence \\%s", s[:size+1])
+	}
+	b.WriteRune(rune(code))
+	return size + 1, nil
+}
@@ -0,0 +1,164 @@
+package yaml_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+// toJSON decodes the YAML document and returns it as JSON, which makes it
+// easy to compare.
+func toJSON(t *testing.T, document string) string {
+	t.Helper()
+	var value any
+	if err := yaml.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatal(err)
+	}
+	output, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+	t.Run("decodes a kubeconfig written by kubectl", func(t *testing.T) {
+		document := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: LS0tLS1CRUdJTg==
+    server: https://127.0.0.1:6443
+  name: kind-kind
+contexts:
+- context:
+    cluster: kind-kind
+    namespace: "default"
+    user: kind-kind
+  name: kind-kind
+current-context: kind-kind
+kind: Config
+preferences: {}
+users:
+- name: kind-kind
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      args:
+        - token
+        - --cluster=kind
+      command: aws
+      env: null
+`
+		expected := `{"apiVersion":"v1","clusters":[{"cluster":{"certificate-authority-data":"LS0tLS1CRUdJTg==","server":"https://127.0.0.1:6443"},"name":"kind-kind"}],` +
+			`"contexts":[{"context":{"cluster":"kind-kind","namespace":"default","user":"kind-kind"},"name":"kind-kind"}],"current-context":"kind-kind","kind":"Config","preferences":{},` +
+			`"users":[{"name":"kind-kind","user":{"exec":{"apiVersion":"client.authentication.k8s.io/v1beta1","args":["token","--cluster=kind"],"command":"aws","env":null}}}]}`
+		assert.Equals(t, expected, toJSON(t, document))
+	})
+
+	t.Run("resolves scalars", func(t *testing.T) {
+		document := `
+# a comment
+null: ~
+bool: true
+int: 42
+float: -1.5e3
+octal: 0755
+version: "1.20"
+single: 'it''s # not a comment'
+double: "tab\there é"
+plain: hello world # a comment
+url: http://example.com:8080/path
+"quoted key": value
+`
+		expected := `{"bool":true,"double":"tab\there é","float":-1500,"int":42,"null":null,"octal":"0755","plain":"hello world","quoted key":"value","single":"it's # not a comment","url":"http://example.com:8080/path","version":"1.20"}`
+		assert.Equals(t, expected, toJSON(t, document))
+	})
+
+	t.Run("decodes block scalars", func(t *testing.T) {
+		document := `literal: |
+  line 1
+    indented
+
+  line 3
+strip: |-
+  no newline
+keep: |+
+  kept
+
+folded: >
+  folded
+  line
+
+  paragraph
+last: end
+`
+		expected := `{"folded":"folded line\nparagraph\n","keep":"kept\n\n","last":"end","literal":"line 1\n  indented\n\nline 3\n","strip":"no newline"}`
+		assert.Equals(t, expected, toJSON(t, document))
+	})
+
+	t.Run("decodes a kept block scalar at the end of the document", func(t *testing.T) {
+		for _, value := range []string{"a\n", "a\n\n", "a\n\n\n"} {
+			document, err := yaml.Marshal(map[string]any{"keep": value})
+			assert.Nil(t, err)
+			var actual map[string]string
+			assert.Nil(t, yaml.Unmarshal(document, &actual))
+			assert.Equals(t, value, actual["keep"])
+		}
+	})
+
+	t.Run("decodes flow collections and nested sequences", func(t *testing.T) {
+		document := `---
+flow: [a, "b, c", {d: 1, e: [f]}]
+empty: []
+nested:
+  - - x
+    - y
+  - z
+folded: a long
+  value on two lines
+`
+		expected := `{"empty":[],"flow":["a","b, c",{"d":1,"e":["f"]}],"folded":"a long value on two lines","nested":[["x","y"],"z"]}`
+		assert.Equals(t, expected, toJSON(t, document))
+	})
+
+	t.Run("only decodes the first document", func(t *testing.T) {
+		assert.Equals(t, `{"a":1}`, toJSON(t, "a: 1\n---\nb: 2\n"))
+	})
+
+	t.Run("decodes JSON", func(t *testing.T) {
+		assert.Equals(t, `{"a":[1,2]}`, toJSON(t, "{\n  \"a\": [1, 2]\n}\n"))
+	})
+
+	t.Run("decodes what Marshal encodes", func(t *testing.T) {
+		value := map[string]any{
+			"data":  map[string]any{"script": "#!/bin/sh\necho hi\n", "yes": "yes", "empty": ""},
+			"items": []any{map[string]any{"a": true, "b": "1"}, []any{"x"}},
+		}
+		document, err := yaml.Marshal(value)
+		assert.Nil(t, err)
+		expected, err := json.Marshal(value)
+		assert.Nil(t, err)
+		assert.Equals(t, string(expected), toJSON(t, string(document)))
+	})
+
+	t.Run("decodes into structs", func(t *testing.T) {
+		var config struct {
+			CurrentContext string `json:"current-context"`
+			Insecure       bool   `json:"insecure"`
+		}
+		err := yaml.Unmarshal([]byte("current-context: prod\ninsecure: true\n"), &config)
+		assert.Nil(t, err)
+		assert.Equals(t, "prod", config.CurrentContext)
+		assert.True(t, config.Insecure)
+	})
+
+	t.Run("returns an error on invalid documents", func(t *testing.T) {
+		var value any
+		assert.NotNil(t, yaml.Unmarshal([]byte("a: 1\n  - b\nc\n"), &value))
+		assert.NotNil(t, yaml.Unmarshal([]byte("a: \"unterminated\n"), &value))
+		assert.NotNil(t, yaml.Unmarshal([]byte("a: [b, c\n"), &value))
+	})
+}
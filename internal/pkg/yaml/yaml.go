@@ -0,0 +1,213 @@
+// Package yaml encodes JSON compatible values to YAML, in the same style as
+// `kubectl get -o yaml`: map keys are sorted and sequences aren't indented
+// under their parent key. It also decodes the subset of YAML found in
+// kubeconfig files.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Marshal returns the YAML encoding of v. The value is first encoded to JSON,
+// so the json struct tags are honored.
+func Marshal(v any) ([]byte, error) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	e := &encoder{buf: &buf}
+	if err := e.encode(value, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf *bytes.Buffer
+}
+
+func (e *encoder) indent(level int) {
+	e.buf.WriteString(strings.Repeat("  ", level))
+}
+
+// encode writes the value at the given indentation level. The caller is
+// expected to have written the indentation of the first line, if any.
+func (e *encoder) encode(value any, level int) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			e.buf.WriteString("{}\n")
+			return nil
+		}
+		for i, key := range sortedKeys(v) {
+			if i > 0 {
+				e.indent(level)
+			}
+			e.buf.WriteString(formatString(key) + ":")
+			if err := e.encodeValue(v[key], level, true); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			e.buf.WriteString("[]\n")
+			return nil
+		}
+		for i, item := range v {
+			if i > 0 {
+				e.indent(level)
+			}
+			e.buf.WriteString("-")
+			if err := e.encodeValue(item, level, false); err != nil {
+				return err
+			}
+		}
+	default:
+		scalar, err := formatScalar(v, level)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteString(scalar + "\n")
+	}
+	return nil
+}
+
+// encodeValue writes the value of a map entry or a sequence item, after the
+// key or dash has been written.
+func (e *encoder) encodeValue(value any, level int, inMap bool) error {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			e.buf.WriteString(" ")
+			return e.encode(v, level)
+		}
+		if inMap {
+			e.buf.WriteString("\n")
+			e.indent(level + 1)
+		} else {
+			e.buf.WriteString(" ")
+		}
+		return e.encode(v, level+1)
+	case []any:
+		if len(v) == 0 {
+			e.buf.WriteString(" ")
+			return e.encode(v, level)
+		}
+		if inMap {
+			// like kubectl, sequences aren't indented under their key
+			e.buf.WriteString("\n")
+			e.indent(level)
+			return e.encode(v, level)
+		}
+		e.buf.WriteString(" ")
+		return e.encode(v, level+1)
+	default:
+		e.buf.WriteString(" ")
+		return e.encode(v, level+1)
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatScalar(value any, level int) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case json.Number:
+		return v.String(), nil
+	case string:
+		if isLiteralBlockCandidate(v) {
+			return formatLiteralBlock(v, level), nil
+		}
+		return formatString(v), nil
+	default:
+		return "", fmt.Errorf("yaml: unsupported type %T", value)
+	}
+}
+
+var (
+	// plainRegex matches the strings that can be written without quotes
+	plainRegex = regexp.MustCompile(`^[A-Za-z0-9_/.][A-Za-z0-9_/.()@=+, -]*$`)
+	// numberRegex matches the strings that a YAML parser could read as numbers
+	numberRegex = regexp.MustCompile(`^[-+]?(\.?[0-9]|0x|0o)`)
+	// reservedWords are read as booleans or null by YAML parsers
+	reservedWords = map[string]bool{
+		"y": true, "yes": true, "n": true, "no": true, "true": true, "false": true,
+		"on": true, "off": true, "null": true, "~": true, ".inf": true, ".nan": true,
+	}
+)
+
+// formatString returns the string as is when it's unambiguous, otherwise it
+// returns it double-quoted.
+func formatString(s string) string {
+	if plainRegex.MatchString(s) &&
+		!strings.HasSuffix(s, " ") &&
+		!numberRegex.MatchString(s) &&
+		!reservedWords[strings.ToLower(s)] {
+		return s
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// encoding a string can't fail
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// isLiteralBlockCandidate returns true for multi-line strings that can be
+// written as literal blocks, which is more readable than a quoted string.
+func isLiteralBlockCandidate(s string) bool {
+	if !strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\n") {
+		return false
+	}
+	for _, r := range s {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatLiteralBlock(s string, level int) string {
+	chomping := "-"
+	if strings.HasSuffix(s, "\n\n") {
+		chomping = "+"
+	} else if strings.HasSuffix(s, "\n") {
+		chomping = ""
+	}
+	indentation := strings.Repeat("  ", level)
+	var block strings.Builder
+	block.WriteString("|" + chomping)
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		block.WriteString("\n")
+		if line != "" {
+			block.WriteString(indentation + line)
+		}
+	}
+	return block.String()
+}
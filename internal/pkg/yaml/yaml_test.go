@@ -0,0 +1,102 @@
+package yaml_test
+
+import (
+	"testing"
+
+	"github.com/duboisf/kubectl-fetch/internal/pkg/testing/assert"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/yaml"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+	t.Run("encodes nested maps and sequences like kubectl", func(t *testing.T) {
+		value := map[string]any{
+			"kind":       "ConfigMap",
+			"apiVersion": "v1",
+			"metadata": map[string]any{
+				"name":   "foo",
+				"labels": map[string]any{"app": "payments"},
+			},
+			"items": []any{
+				map[string]any{"b": 1, "a": true},
+				[]any{"x", "y"},
+				"z",
+			},
+			"empty": map[string]any{},
+			"none":  []any{},
+			"null":  nil,
+		}
+		actual, err := yaml.Marshal(value)
+		assert.Nil(t, err)
+		expected := `apiVersion: v1
+empty: {}
+items:
+- a: true
+  b: 1
+- - x
+  - "y"
+- z
+kind: ConfigMap
+metadata:
+  labels:
+    app: payments
+  name: foo
+none: []
+"null": null
+`
+		assert.Equals(t, expected, string(actual))
+	})
+
+	t.Run("quotes ambiguous strings", func(t *testing.T) {
+		actual, err := yaml.Marshal([]any{"", "true", "No", "1.5", "0x1f", "-foo", "a: b", "2022-01-01T00:00:00Z", "trailing ", "<html>", "nginx-1.25"})
+		assert.Nil(t, err)
+		expected := `- ""
+- "true"
+- "No"
+- "1.5"
+- "0x1f"
+- "-foo"
+- "a: b"
+- "2022-01-01T00:00:00Z"
+- "trailing "
+- "<html>"
+- nginx-1.25
+`
+		assert.Equals(t, expected, string(actual))
+	})
+
+	t.Run("writes multi-line strings as literal blocks", func(t *testing.T) {
+		actual, err := yaml.Marshal(map[string]any{
+			"data": map[string]any{
+				"clip":  "a\n\nb",
+				"keep":  "a\n\n",
+				"strip": "a\nb\n",
+			},
+		})
+		assert.Nil(t, err)
+		expected := `data:
+  clip: |-
+    a
+
+    b
+  keep: |+
+    a
+
+  strip: |
+    a
+    b
+`
+		assert.Equals(t, expected, string(actual))
+	})
+
+	t.Run("honors json struct tags", func(t *testing.T) {
+		type record struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace,omitempty"`
+			Count     int64  `json:"count"`
+		}
+		actual, err := yaml.Marshal(&record{Name: "foo", Count: 9007199254740993})
+		assert.Nil(t, err)
+		assert.Equals(t, "count: 9007199254740993\nname: foo\n", string(actual))
+	})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,14 +11,24 @@ import (
 	"time"
 
 	"github.com/duboisf/kubectl-fetch/internal/cmd"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/discovery"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/kubectl"
+	"github.com/duboisf/kubectl-fetch/internal/pkg/rest"
 	"github.com/duboisf/kubectl-fetch/internal/pkg/terminal"
 )
 
+// exitCodePartialFailure is the exit code when running with --keep-going and
+// some resources could not be fetched.
+const exitCodePartialFailure = 3
+
 func main() {
 	err := Main()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
+		var partialErr *cmd.PartialFetchError
+		if errors.As(err, &partialErr) {
+			os.Exit(exitCodePartialFailure)
+		}
 		os.Exit(1)
 	}
 }
@@ -32,20 +43,84 @@ func Main() error {
 	backgroundColor, _ := tput.Query("setab 0")
 	resetColor, _ := tput.Query("sgr0")
 	progressBar := terminal.NewProgressBar(foregroundColor, backgroundColor, resetColor)
-	spinner := terminal.NewSpinner(100*time.Millisecond)
+	spinner := terminal.NewSpinner(100 * time.Millisecond)
 	tui := terminal.NewUI(progressBar, spinner, tput, os.Stderr)
-	kubeClient := kubectl.New(exec.CommandContext)
 	opts, err := cmd.GetOptions(os.Args[1:])
 	if err != nil {
 		return err
 	}
-	plugin, err := cmd.NewPlugin(kubeClient, opts, tui)
+	newKubeClient, err := newKubeClientFactory(opts)
+	if err != nil {
+		return err
+	}
+	plugin, err := cmd.NewPlugin(newKubeClient(""), opts, tui)
 	if err != nil {
 		return err
 	}
-	cmd, err := cmd.NewCmd(plugin, os.Stdout, os.Stderr, tui)
+	plugin.NewKubeClient = newKubeClient
+	cmd, err := cmd.NewCmd(plugin, opts, os.Stdout, os.Stderr, tui)
 	if err != nil {
 		return err
 	}
 	return cmd.Run(ctx)
 }
+
+// newKubeClientFactory returns a factory of KubeClients for the backend
+// selected on the command line. The factory returns a KubeClient for the
+// current context when it's called with an empty context.
+func newKubeClientFactory(opts *cmd.Options) (cmd.KubeClientFactory, error) {
+	if opts.Backend == cmd.BackendREST {
+		kubeconfig, err := rest.LoadKubeconfig(opts.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return func(kubeContext string) cmd.KubeClient {
+			overrides := rest.Overrides{
+				Context:        opts.Context,
+				Cluster:        opts.Cluster,
+				User:           opts.User,
+				As:             opts.As,
+				AsGroups:       opts.AsGroups,
+				RequestTimeout: opts.RequestTimeout,
+			}
+			if kubeContext != "" {
+				overrides.Context = kubeContext
+			}
+			client := rest.New(kubeconfig, overrides)
+			client.LabelSelector = opts.LabelSelector
+			client.FieldSelector = opts.FieldSelector
+			client.FullObjects = opts.FullObjects()
+			return client
+		}, nil
+	}
+	discoveryCache := newDiscoveryCache(opts)
+	return func(kubeContext string) cmd.KubeClient {
+		globalFlags := opts.KubectlFlags()
+		if kubeContext != "" {
+			globalFlags = append(globalFlags, "--context="+kubeContext)
+		}
+		k := kubectl.New(exec.CommandContext, globalFlags...)
+		k.LabelSelector = opts.LabelSelector
+		k.FieldSelector = opts.FieldSelector
+		k.FullObjects = opts.FullObjects()
+		if discoveryCache != nil {
+			k.DiscoveryCache = discoveryCache
+		}
+		return k
+	}, nil
+}
+
+// newDiscoveryCache returns the cache of the API resources of the clusters,
+// or nil when it's disabled or when there's no cache directory.
+func newDiscoveryCache(opts *cmd.Options) *discovery.Cache {
+	if opts.DiscoveryTTL <= 0 {
+		return nil
+	}
+	dir, err := discovery.DefaultDir()
+	if err != nil {
+		return nil
+	}
+	cache := discovery.NewCache(dir, opts.DiscoveryTTL)
+	cache.Refresh = opts.RefreshDiscovery
+	return cache
+}